@@ -16,6 +16,10 @@ func (ie InfixExpr) expressionNode() {}
 func (ie InfixExpr) TokenLiteral() string {
 	return ie.Op.Literal
 }
+
+func (ie InfixExpr) Span() tokens.Span {
+	return cover(ie.Op.Span(), ie.Left, ie.Right)
+}
 func (ie InfixExpr) Str() string {
 	return fmt.Sprintf("[%s %s %s]",
 		ie.Left.Str(),
@@ -33,6 +37,10 @@ func (pe PrefixExpr) TokenLiteral() string {
 	return pe.Op.Literal
 }
 
+func (pe PrefixExpr) Span() tokens.Span {
+	return cover(pe.Op.Span(), pe.Right)
+}
+
 func (pe PrefixExpr) Str() string {
 	return fmt.Sprintf("[%s %s]",
 		pe.Op.Literal,
@@ -49,6 +57,10 @@ func (n IntNode) TokenLiteral() string {
 	return n.Token.Literal
 }
 
+func (n IntNode) Span() tokens.Span {
+	return n.Token.Span()
+}
+
 func (n IntNode) Str() string {
 	return n.Token.Literal
 }
@@ -63,6 +75,10 @@ func (fn FloatNode) TokenLiteral() string {
 	return fn.Token.Literal
 }
 
+func (fn FloatNode) Span() tokens.Span {
+	return fn.Token.Span()
+}
+
 func (fn FloatNode) Str() string {
 	return fn.Token.Literal
 }
@@ -77,6 +93,10 @@ func (i IdentNode) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i IdentNode) Span() tokens.Span {
+	return i.Token.Span()
+}
+
 func (i IdentNode) Str() string {
 	return i.Value
 }
@@ -96,6 +116,10 @@ func (b BooleanNode) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b BooleanNode) Span() tokens.Span {
+	return b.Token.Span()
+}
+
 func (b BooleanNode) Str() string {
 	return strconv.FormatBool(b.Value)
 }
@@ -110,10 +134,48 @@ func (s StringNode) TokenLiteral() string {
 	return s.Token.Literal
 }
 
+func (s StringNode) Span() tokens.Span {
+	return s.Token.Span()
+}
+
 func (s StringNode) Str() string {
 	return "'" + s.Value + "'"
 }
 
+// FString 是插值字符串, Parts 中为普通文本的 StringNode 或表达式, Specs 为对应的格式说明
+type FString struct {
+	Token tokens.Token
+	Parts []Expression
+	Specs []string
+}
+
+func (f FString) expressionNode() {}
+func (f FString) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f FString) Span() tokens.Span {
+	return f.Token.Span()
+}
+
+func (f FString) Str() string {
+	var sb strings.Builder
+	sb.WriteString("f'")
+	for i, part := range f.Parts {
+		if s, ok := part.(StringNode); ok {
+			sb.WriteString(s.Value)
+			continue
+		}
+		sb.WriteString("{" + part.Str())
+		if f.Specs[i] != "" {
+			sb.WriteString(":" + f.Specs[i])
+		}
+		sb.WriteString("}")
+	}
+	sb.WriteString("'")
+	return sb.String()
+}
+
 type NoneNode struct {
 	Token tokens.Token
 }
@@ -123,14 +185,88 @@ func (n NoneNode) TokenLiteral() string {
 	return n.Token.Literal
 }
 
+func (n NoneNode) Span() tokens.Span {
+	return n.Token.Span()
+}
+
 func (n NoneNode) Str() string {
 	return "None"
 }
 
+// CompareChain 是连续的比较 a < b <= c, 等价于 a < b and b <= c, 但中间的操作数只求值一次
+type CompareChain struct {
+	Operands []Expression
+	Ops      []tokens.Token
+}
+
+func (c CompareChain) expressionNode() {}
+func (c CompareChain) TokenLiteral() string {
+	return c.Ops[0].Literal
+}
+
+func (c CompareChain) Span() tokens.Span {
+	var span tokens.Span
+	for _, operand := range c.Operands {
+		span = cover(span, operand)
+	}
+	return span
+}
+
+func (c CompareChain) Str() string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, operand := range c.Operands {
+		if i > 0 {
+			sb.WriteString(" " + c.Ops[i-1].Literal + " ")
+		}
+		if operand != nil {
+			sb.WriteString(operand.Str())
+		}
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// ConditionalExpr 是 a if cond else b, 只求值被选中的一边
+type ConditionalExpr struct {
+	Token       tokens.Token // if
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (c ConditionalExpr) expressionNode() {}
+func (c ConditionalExpr) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c ConditionalExpr) Span() tokens.Span {
+	return cover(c.Token.Span(), c.Consequence, c.Condition, c.Alternative)
+}
+
+func (c ConditionalExpr) Str() string {
+	var sb strings.Builder
+	sb.WriteString("(")
+	if c.Consequence != nil {
+		sb.WriteString(c.Consequence.Str())
+	}
+	sb.WriteString(" if ")
+	if c.Condition != nil {
+		sb.WriteString(c.Condition.Str())
+	}
+	sb.WriteString(" else ")
+	if c.Alternative != nil {
+		sb.WriteString(c.Alternative.Str())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
 type IfExpression struct {
 	Token       tokens.Token //"if" token
 	Condition   Expression
 	Consequence *BlockStatement
+	ElseIf      *IfExpression // else if 分支, 链上只有最后一个节点可以有 Alternative
 	Alternative *BlockStatement
 }
 
@@ -139,11 +275,28 @@ func (i IfExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i IfExpression) Span() tokens.Span {
+	span := cover(i.Token.Span(), i.Condition)
+	if i.Consequence != nil {
+		span = span.Cover(i.Consequence.Span())
+	}
+	if i.ElseIf != nil {
+		span = span.Cover(i.ElseIf.Span())
+	}
+	if i.Alternative != nil {
+		span = span.Cover(i.Alternative.Span())
+	}
+	return span
+}
+
 func (i IfExpression) Str() string {
 	var sb strings.Builder
 	sb.WriteString("If (")
 	sb.WriteString(i.Condition.Str() + ") ")
 	sb.WriteString(i.Consequence.Str())
+	if i.ElseIf != nil {
+		sb.WriteString(" Else " + i.ElseIf.Str())
+	}
 	if i.Alternative != nil {
 		sb.WriteString(" Else (")
 		sb.WriteString(i.Alternative.Str() + ") ")
@@ -153,6 +306,7 @@ func (i IfExpression) Str() string {
 
 type ForExpression struct {
 	Token       tokens.Token
+	Label       string
 	InitCond    Statement
 	Condition   Expression
 	EachOperate Statement
@@ -164,8 +318,19 @@ func (fe ForExpression) TokenLiteral() string {
 	return fe.Token.Literal
 }
 
+func (fe ForExpression) Span() tokens.Span {
+	span := fe.Token.Span()
+	if fe.Loop != nil {
+		span = span.Cover(fe.Loop.Span())
+	}
+	return span
+}
+
 func (fe ForExpression) Str() string {
 	var sb strings.Builder
+	if fe.Label != "" {
+		sb.WriteString(fe.Label + ": ")
+	}
 	sb.WriteString("For (")
 	if fe.InitCond != nil {
 		sb.WriteString(fe.InitCond.Str() + ";")
@@ -185,11 +350,54 @@ func (fe ForExpression) Str() string {
 	return sb.String()
 }
 
+// ForInExpression 是 for (k, v in iterable) {...} 形式的循环, 只有一个变量时 Key 为 nil
+type ForInExpression struct {
+	Token    tokens.Token
+	Label    string
+	Key      *IdentNode
+	Value    IdentNode
+	Iterable Expression
+	Loop     *BlockStatement
+}
+
+func (fi ForInExpression) expressionNode() {}
+func (fi ForInExpression) TokenLiteral() string {
+	return fi.Token.Literal
+}
+
+func (fi ForInExpression) Span() tokens.Span {
+	span := fi.Token.Span()
+	if fi.Loop != nil {
+		span = span.Cover(fi.Loop.Span())
+	}
+	return span
+}
+
+func (fi ForInExpression) Str() string {
+	var sb strings.Builder
+	if fi.Label != "" {
+		sb.WriteString(fi.Label + ": ")
+	}
+	sb.WriteString("For (")
+	if fi.Key != nil {
+		sb.WriteString(fi.Key.Str() + ", ")
+	}
+	sb.WriteString(fi.Value.Str() + " in " + fi.Iterable.Str() + ")")
+	sb.WriteString(fi.Loop.Str())
+	return sb.String()
+}
+
 type FuncDef struct {
 	Token      tokens.Token
 	Parameters []IdentNode
 	FuncBody   *BlockStatement
 	Name       string
+	// Defaults 是最后 len(Defaults) 个参数的默认值, 在定义函数时求值
+	Defaults []Expression
+	// Rest 是以 ...rest 声明的参数, 收集多余的位置参数, 不计入 Parameters
+	Rest *IdentNode
+	// Anonymous 表示匿名函数, Name 由解析器生成, 函数本身作为表达式的值
+	Anonymous bool
 }
 
 func (fd FuncDef) expressionNode() {}
@@ -197,11 +405,27 @@ func (fd FuncDef) TokenLiteral() string {
 	return fd.Token.Literal
 }
 
+func (fd FuncDef) Span() tokens.Span {
+	span := fd.Token.Span()
+	if fd.FuncBody != nil {
+		span = span.Cover(fd.FuncBody.Span())
+	}
+	return span
+}
+
 func (fd FuncDef) Str() string {
 	var sb strings.Builder
 	var params []string
-	for _, p := range fd.Parameters {
-		params = append(params, p.Str())
+	first := len(fd.Parameters) - len(fd.Defaults)
+	for i, p := range fd.Parameters {
+		if i >= first {
+			params = append(params, p.Str()+"="+fd.Defaults[i-first].Str())
+		} else {
+			params = append(params, p.Str())
+		}
+	}
+	if fd.Rest != nil {
+		params = append(params, "..."+fd.Rest.Str())
 	}
 	sb.WriteString(fmt.Sprintf("Func: %s(", fd.Name))
 	sb.WriteString(strings.Join(params, ",") + ")\n{")
@@ -209,10 +433,18 @@ func (fd FuncDef) Str() string {
 	return sb.String()
 }
 
+// KeywordArg 是调用时以 name = value 形式传入的参数
+type KeywordArg struct {
+	Name  IdentNode
+	Value Expression
+}
+
 type FuncCallExpr struct {
 	Token     tokens.Token
 	Function  Expression
 	Arguments []Expression
+	Keywords  []KeywordArg
+	End       tokens.Locate // ")" 之后的位置
 }
 
 func (fc FuncCallExpr) expressionNode() {}
@@ -220,12 +452,19 @@ func (fc FuncCallExpr) TokenLiteral() string {
 	return fc.Token.Literal
 }
 
+func (fc FuncCallExpr) Span() tokens.Span {
+	return cover(tokens.Span{Start: fc.Token.Loc, End: fc.End}, fc.Function)
+}
+
 func (fc FuncCallExpr) Str() string {
 	var sb strings.Builder
 	var args []string
 	for _, arg := range fc.Arguments {
 		args = append(args, arg.Str())
 	}
+	for _, kw := range fc.Keywords {
+		args = append(args, kw.Name.Str()+"="+kw.Value.Str())
+	}
 	sb.WriteString(fc.Function.Str())
 	sb.WriteString("(" + strings.Join(args, ",") + ")")
 	return sb.String()
@@ -234,6 +473,7 @@ func (fc FuncCallExpr) Str() string {
 type Array struct {
 	Token    tokens.Token
 	Elements []Expression
+	End      tokens.Locate // "]" 之后的位置
 }
 
 func (a Array) expressionNode() {}
@@ -241,6 +481,10 @@ func (a Array) TokenLiteral() string {
 	return a.Token.Literal
 }
 
+func (a Array) Span() tokens.Span {
+	return tokens.Span{Start: a.Token.Loc, End: a.End}
+}
+
 func (a Array) Str() string {
 	var sb strings.Builder
 	sb.WriteString("[")
@@ -256,6 +500,7 @@ func (a Array) Str() string {
 }
 
 type IndexSlice struct {
+	Token            tokens.Token // 第一个 ":"
 	Start, End, Step Expression
 }
 
@@ -264,6 +509,10 @@ func (is IndexSlice) TokenLiteral() string {
 	return ""
 }
 
+func (is IndexSlice) Span() tokens.Span {
+	return cover(is.Token.Span(), is.Start, is.End, is.Step)
+}
+
 func (is IndexSlice) Str() string {
 	var sb strings.Builder
 	var start, end, step string
@@ -290,6 +539,7 @@ type IndexExpression struct {
 	Token tokens.Token
 	Left,
 	Index Expression
+	End tokens.Locate // "]" 之后的位置
 }
 
 func (i IndexExpression) expressionNode() {}
@@ -297,6 +547,10 @@ func (i IndexExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i IndexExpression) Span() tokens.Span {
+	return cover(tokens.Span{Start: i.Token.Loc, End: i.End}, i.Left)
+}
+
 func (i IndexExpression) Str() string {
 	var sb strings.Builder
 	sb.WriteString(i.Left.Str())
@@ -308,6 +562,7 @@ type Map struct {
 	Token tokens.Token
 	Keys,
 	Items []Expression
+	End tokens.Locate // "}" 之后的位置
 }
 
 func (m Map) expressionNode() {}
@@ -315,6 +570,10 @@ func (m Map) TokenLiteral() string {
 	return m.Token.Literal
 }
 
+func (m Map) Span() tokens.Span {
+	return tokens.Span{Start: m.Token.Loc, End: m.End}
+}
+
 func (m Map) Str() string {
 	var sb strings.Builder
 	sb.WriteString("{")
@@ -334,15 +593,21 @@ func (mn MethodNode) TokenLiteral() string {
 	return mn.Token.Literal
 }
 
+func (mn MethodNode) Span() tokens.Span {
+	return mn.Token.Span()
+}
+
 func (mn MethodNode) Str() string {
 	return mn.Value
 }
 
+// MethodCall 是 Left.Method(Arguments), Left 可以是任意表达式, 连续的调用逐层嵌套
 type MethodCall struct {
 	Token     tokens.Token
 	Left      Expression
-	Methods   []Expression
-	Arguments [][]Expression
+	Method    Expression
+	Arguments []Expression
+	End       tokens.Locate // ")" 之后的位置
 }
 
 func (mc MethodCall) expressionNode() {}
@@ -350,28 +615,22 @@ func (mc MethodCall) TokenLiteral() string {
 	return mc.Token.Literal
 }
 
+func (mc MethodCall) Span() tokens.Span {
+	return cover(tokens.Span{Start: mc.Token.Loc, End: mc.End}, mc.Left)
+}
+
 func (mc MethodCall) Str() string {
-	var sb strings.Builder
-	sb.WriteString(mc.Left.Str() + ".")
-	for i, m := range mc.Methods {
-		sb.WriteString(m.Str() + "(")
-		for idx, arg := range mc.Arguments[i] {
-			if idx != len(mc.Arguments[i])-1 {
-				sb.WriteString(arg.Str() + ",")
-			} else {
-				sb.WriteString(arg.Str())
-			}
-		}
-		sb.WriteString(")")
-		if i != len(mc.Methods)-1 {
-			sb.WriteString(".")
-		}
+	var args []string
+	for _, arg := range mc.Arguments {
+		args = append(args, arg.Str())
 	}
-	return sb.String()
+	return mc.Left.Str() + "." + mc.Method.Str() + "(" + strings.Join(args, ",") + ")"
 }
 
+// BreakExpr 跳出循环, Label 不为空时跳出对应标签的循环
 type BreakExpr struct {
 	Token tokens.Token
+	Label *IdentNode
 }
 
 func (b BreakExpr) expressionNode() {}
@@ -379,6 +638,63 @@ func (b BreakExpr) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b BreakExpr) Span() tokens.Span {
+	if b.Label != nil {
+		return cover(b.Token.Span(), b.Label)
+	}
+	return b.Token.Span()
+}
+
 func (b BreakExpr) Str() string {
+	if b.Label != nil {
+		return b.Token.Literal + " " + b.Label.Value
+	}
 	return b.Token.Literal
 }
+
+// SpreadExpr 是调用参数中的 ...expr, 运行时把数组或其他可迭代对象展开为多个位置参数
+type SpreadExpr struct {
+	Token tokens.Token
+	Value Expression
+}
+
+func (s SpreadExpr) expressionNode() {}
+func (s SpreadExpr) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s SpreadExpr) Span() tokens.Span {
+	return cover(s.Token.Span(), s.Value)
+}
+
+func (s SpreadExpr) Str() string {
+	if s.Value == nil {
+		return "..."
+	}
+	return "..." + s.Value.Str()
+}
+
+// ContinueExpr 进入循环的下一轮, Label 的含义与 BreakExpr 相同
+type ContinueExpr struct {
+	Token tokens.Token
+	Label *IdentNode
+}
+
+func (c ContinueExpr) expressionNode() {}
+func (c ContinueExpr) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c ContinueExpr) Span() tokens.Span {
+	if c.Label != nil {
+		return cover(c.Token.Span(), c.Label)
+	}
+	return c.Token.Span()
+}
+
+func (c ContinueExpr) Str() string {
+	if c.Label != nil {
+		return c.Token.Literal + " " + c.Label.Value
+	}
+	return c.Token.Literal
+}
@@ -18,6 +18,14 @@ func (p Program) TokenLiteral() string {
 	}
 }
 
+func (p Program) Span() tokens.Span {
+	var span tokens.Span
+	for _, s := range p.Statements {
+		span = span.Cover(s.Span())
+	}
+	return span
+}
+
 func (p Program) Str() string {
 	var sb strings.Builder
 	for idx, s := range p.Statements {
@@ -41,6 +49,10 @@ func (vs VarStatement) TokenLiteral() string {
 	return vs.Token.Literal
 }
 
+func (vs VarStatement) Span() tokens.Span {
+	return cover(vs.Token.Span(), vs.Indent, vs.Value)
+}
+
 func (vs VarStatement) Str() string {
 	var sb strings.Builder
 	sb.WriteString(vs.TokenLiteral() + " ")
@@ -51,41 +63,6 @@ func (vs VarStatement) Str() string {
 	return sb.String()
 }
 
-type VarMethodCall struct {
-	Token  tokens.Token // Var tokens
-	Indent IdentNode
-	Value  Expression
-}
-
-func (v VarMethodCall) StatementNode() {}
-func (v VarMethodCall) TokenLiteral() string {
-	return v.Token.Literal
-}
-
-func (v VarMethodCall) Str() string {
-	var sb strings.Builder
-	sb.WriteString(v.TokenLiteral() + " ")
-	sb.WriteString(v.Indent.Str() + " = ")
-	if v.Value != nil {
-		sb.WriteString(v.Value.Str() + " <Method>")
-	}
-	return sb.String()
-}
-
-type MethodCallStmt struct {
-	Token tokens.Token
-	Call  Expression
-}
-
-func (m MethodCallStmt) StatementNode() {}
-func (m MethodCallStmt) TokenLiteral() string {
-	return m.Token.Literal
-}
-
-func (m MethodCallStmt) Str() string {
-	return m.Call.Str()
-}
-
 type ReturnStatement struct {
 	Token     tokens.Token // Return tokens
 	ReturnVal Expression
@@ -96,6 +73,10 @@ func (rs ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs ReturnStatement) Span() tokens.Span {
+	return cover(rs.Token.Span(), rs.ReturnVal)
+}
+
 func (rs ReturnStatement) Str() string {
 	var sb strings.Builder
 	sb.WriteString(rs.TokenLiteral() + " ")
@@ -115,6 +96,10 @@ func (as AssignStatement) StatementNode() {}
 func (as AssignStatement) TokenLiteral() string {
 	return as.Ident.Literal
 }
+
+func (as AssignStatement) Span() tokens.Span {
+	return cover(as.Ident.Span(), as.Statement)
+}
 func (as AssignStatement) Str() string {
 	var sb strings.Builder
 	sb.WriteString("assign: " + as.Identifier.Value + " = ")
@@ -122,6 +107,49 @@ func (as AssignStatement) Str() string {
 	return sb.String()
 }
 
+// UnpackAssign 是多目标赋值, 目标为标识符或 [a, b] 形式的嵌套目标.
+// 只有一个值时把它解包到各个目标, 否则值和目标一一对应
+type UnpackAssign struct {
+	Token   tokens.Token // var 或第一个目标的 token
+	Targets []Expression
+	Values  []Expression
+}
+
+func (ua UnpackAssign) StatementNode() {}
+func (ua UnpackAssign) TokenLiteral() string {
+	return ua.Token.Literal
+}
+
+func (ua UnpackAssign) Span() tokens.Span {
+	span := ua.Token.Span()
+	for _, t := range ua.Targets {
+		span = cover(span, t)
+	}
+	for _, v := range ua.Values {
+		span = cover(span, v)
+	}
+	return span
+}
+
+func (ua UnpackAssign) Str() string {
+	var targets, values []string
+	for _, t := range ua.Targets {
+		if t != nil {
+			targets = append(targets, t.Str())
+		}
+	}
+	for _, v := range ua.Values {
+		if v != nil {
+			values = append(values, v.Str())
+		}
+	}
+	prefix := "assign: "
+	if ua.Token.Type == tokens.Var {
+		prefix = ua.TokenLiteral() + " "
+	}
+	return prefix + strings.Join(targets, ", ") + " = " + strings.Join(values, ", ")
+}
+
 type ExprStatement struct {
 	Expression Expression
 }
@@ -131,6 +159,10 @@ func (es ExprStatement) TokenLiteral() string {
 	return es.Expression.TokenLiteral()
 }
 
+func (es ExprStatement) Span() tokens.Span {
+	return cover(tokens.Span{}, es.Expression)
+}
+
 func (es ExprStatement) Str() string {
 	if es.Expression != nil {
 		return es.Expression.Str()
@@ -147,6 +179,10 @@ func (fs FuncStatement) TokenLiteral() string {
 	return fs.Expression.TokenLiteral()
 }
 
+func (fs FuncStatement) Span() tokens.Span {
+	return cover(tokens.Span{}, fs.Expression)
+}
+
 func (fs FuncStatement) Str() string {
 	if fs.Expression != nil {
 		return fs.Expression.Str()
@@ -157,6 +193,7 @@ func (fs FuncStatement) Str() string {
 type BlockStatement struct {
 	Token      tokens.Token
 	Statements []Statement
+	End        tokens.Locate // "}" 之后的位置
 }
 
 func (bs BlockStatement) StatementNode() {}
@@ -164,6 +201,10 @@ func (bs BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs BlockStatement) Span() tokens.Span {
+	return tokens.Span{Start: bs.Token.Loc, End: bs.End}
+}
+
 func (bs BlockStatement) Str() string {
 	var sb strings.Builder
 	sb.WriteString("Stmts:{")
@@ -177,9 +218,12 @@ func (bs BlockStatement) Str() string {
 	return sb.String()
 }
 
+// ExpressionAssign 是 Old[Key] = New, Old 本身也可以是索引表达式, 例如 grid[i][j] = 0
 type ExpressionAssign struct {
 	Token         tokens.Token
 	Old, Key, New Expression
+	// Op 是 += 等复合赋值运算符, 普通赋值时为 nil
+	Op *tokens.Token
 }
 
 func (ea ExpressionAssign) StatementNode() {}
@@ -187,6 +231,14 @@ func (ea ExpressionAssign) TokenLiteral() string {
 	return ea.Token.Literal
 }
 
+func (ea ExpressionAssign) Span() tokens.Span {
+	return cover(ea.Token.Span(), ea.Old, ea.Key, ea.New)
+}
+
 func (ea ExpressionAssign) Str() string {
-	return ea.Old.Str() + "[" + ea.Key.Str() + "] = " + ea.New.Str()
+	op := "="
+	if ea.Op != nil {
+		op = ea.Op.Literal
+	}
+	return ea.Old.Str() + "[" + ea.Key.Str() + "] " + op + " " + ea.New.Str()
 }
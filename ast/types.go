@@ -1,8 +1,11 @@
 package ast
 
+import "Interpreter/tokens"
+
 type Node interface {
 	TokenLiteral() string
 	Str() string
+	Span() tokens.Span // 节点在源码中的区间, 用于在错误信息中标出位置
 }
 
 type Expression interface {
@@ -14,3 +17,13 @@ type Statement interface {
 	Node
 	StatementNode()
 }
+
+// cover 把 span 扩展到包含所有非空的子节点
+func cover(span tokens.Span, nodes ...Node) tokens.Span {
+	for _, n := range nodes {
+		if n != nil {
+			span = span.Cover(n.Span())
+		}
+	}
+	return span
+}
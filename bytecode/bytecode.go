@@ -11,6 +11,7 @@ import (
 
 type Bytecode struct {
 	Instruction code.Instructions
+	Spans       code.SpanTable
 	Constants   []object.Object
 	Symbols     *parser.SymTable
 }
@@ -59,7 +60,7 @@ func (b *Bytecode) getArgs(def code.Definition, operand []int, scope *parser.Sym
 		idx = operand[0]
 		args = strconv.Itoa(operand[0])
 	case 2:
-		args = strconv.Itoa(operand[0]) + strconv.Itoa(operand[1])
+		args = strconv.Itoa(operand[0]) + " " + strconv.Itoa(operand[1])
 	default:
 		args = ""
 	}
@@ -79,6 +80,10 @@ func (b *Bytecode) getArgs(def code.Definition, operand []int, scope *parser.Sym
 		var argSb strings.Builder
 		argSb.WriteString("Get Func <" + fn.FnName + ">")
 		return argSb.String()
+	case "OpGetFree", "OpSetFree":
+		if idx < len(scope.FreeSymbols) {
+			args = scope.FreeSymbols[idx].Name
+		}
 	case "OpGetBuiltin":
 		builtIn := object.BuiltinFns[idx]
 		args = builtIn.Name
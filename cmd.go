@@ -0,0 +1,242 @@
+package main
+
+import (
+	"Interpreter/bytecode"
+	"Interpreter/compiler"
+	"Interpreter/errors"
+	"Interpreter/lexer"
+	"Interpreter/object"
+	"Interpreter/parser"
+	"Interpreter/repl"
+	"Interpreter/vm"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 进程退出码
+const (
+	exitOK      = 0
+	exitRuntime = 1
+	exitSyntax  = 2
+	exitUsage   = 64
+)
+
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "<file> [args...]", "compile and run a script", cmdRun},
+		{"repl", "", "start an interactive session", cmdRepl},
+		{"disasm", "<file>", "print the bytecode of a script", cmdDisasm},
+		{"check", "<file>", "parse and compile a script, then report errors", cmdCheck},
+		{"help", "", "show this message", cmdHelp},
+	}
+}
+
+func execute(args []string) int {
+	if len(args) == 0 {
+		return cmdRepl(args)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	if strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		if args[0] == "-h" || args[0] == "--help" {
+			return cmdHelp(nil)
+		}
+		fmt.Fprintf(os.Stderr, "xlang: unknown flag %s\n", args[0])
+		usage(os.Stderr)
+		return exitUsage
+	}
+	// xlang file.x ... 也是 "#!/usr/bin/env xlang" 脚本的调用方式
+	return cmdRun(args)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: xlang <command> [arguments]")
+	fmt.Fprintln(w, "       xlang <file> [args...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-28s %s\n", cmd.name+" "+cmd.args, cmd.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Use "-" as <file> to read the script from stdin.`)
+}
+
+func cmdHelp(_ []string) int {
+	usage(os.Stdout)
+	return exitOK
+}
+
+func cmdRun(args []string) int {
+	path, ok := fileArg("run", args)
+	if !ok {
+		return exitUsage
+	}
+	bc, code := load(path)
+	if bc == nil {
+		return code
+	}
+	object.SetArgs(args)
+	machine := vm.NewVM()
+	if err := machine.Run(bc); err != nil {
+		fmt.Fprintln(os.Stderr, errors.RenderLines(err, source(path)))
+		return exitRuntime
+	}
+	return exitOK
+}
+
+func cmdDisasm(args []string) int {
+	path, ok := fileArg("disasm", args)
+	if !ok {
+		return exitUsage
+	}
+	bc, code := load(path)
+	if bc == nil {
+		return code
+	}
+	fmt.Print(bc.Ins())
+	return exitOK
+}
+
+func cmdCheck(args []string) int {
+	path, ok := fileArg("check", args)
+	if !ok {
+		return exitUsage
+	}
+	bc, code := load(path)
+	if bc == nil {
+		return code
+	}
+	fmt.Printf("%s: ok\n", path)
+	return exitOK
+}
+
+func cmdRepl(_ []string) int {
+	repl.New(os.Stdout).Start(os.Stdin)
+	return exitOK
+}
+
+func fileArg(name string, args []string) (string, bool) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "xlang %s: missing script file\n", name)
+		usage(os.Stderr)
+		return "", false
+	}
+	return args[0], true
+}
+
+// load 读取并编译脚本, 失败时返回 nil 和对应的退出码
+func load(path string) (*bytecode.Bytecode, int) {
+	var in io.Reader
+	if path == "-" {
+		in = io.TeeReader(os.Stdin, &stdin)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "xlang:", err)
+			return nil, exitUsage
+		}
+		defer f.Close()
+		in = f
+	}
+	bc, errs := build(in)
+	if len(errs) > 0 {
+		printErrs(path, source(path), errs)
+		return nil, exitSyntax
+	}
+	return bc, exitOK
+}
+
+// build 完成 词法分析 -> 语法分析 -> 编译, 返回字节码或全部错误.
+// 首行的 "#!" 会被当作注释跳过
+func build(in io.Reader) (*bytecode.Bytecode, []error) {
+	lex := lexer.NewReaderLexer(in)
+	p := parser.NewParser(lex)
+	program := p.Parse()
+	errs := append(lex.Errs(), p.Errs()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	c := compiler.NewCompiler()
+	c.SetSymbol(p.SymTable)
+	c.Compile(program)
+	if c.HasError() {
+		return nil, c.Errs()
+	}
+	return c.ByteCode(), nil
+}
+
+// tailLines 是从标准输入读取脚本时保留的行数
+const tailLines = 1000
+
+// lineTail 只保留写入内容的最后 tailLines 行, 用于显示出错的源码行.
+// 标准输入无法重读, 更早的行出错时只显示错误信息
+type lineTail struct {
+	lines [tailLines]string
+	n     int // 已经读完的行数
+	cur   strings.Builder
+}
+
+func (t *lineTail) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			t.lines[t.n%tailLines] = t.cur.String()
+			t.n++
+			t.cur.Reset()
+		} else {
+			t.cur.WriteByte(b)
+		}
+	}
+	return len(p), nil
+}
+
+// line 返回第 n 行 (从 1 开始), 已经丢弃或者还没有读到时返回 false
+func (t *lineTail) line(n int) (string, bool) {
+	switch {
+	case n == t.n+1:
+		return t.cur.String(), true
+	case n < 1 || n > t.n || n <= t.n-tailLines:
+		return "", false
+	}
+	return t.lines[(n-1)%tailLines], true
+}
+
+var stdin lineTail
+
+// source 返回按行号取源码行的函数, 只在需要显示出错的源码行时读取文件
+func source(path string) func(n int) (string, bool) {
+	if path == "-" {
+		return stdin.line
+	}
+	var lines []string
+	return func(n int) (string, bool) {
+		if lines == nil {
+			data, _ := os.ReadFile(path)
+			lines = strings.Split(string(data), "\n")
+		}
+		if n < 1 || n > len(lines) {
+			return "", false
+		}
+		return lines[n-1], true
+	}
+}
+
+// printErrs 输出全部错误, 语法错误会附上出错的源码行
+func printErrs(path string, line func(n int) (string, bool), errs []error) {
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, errors.RenderLines(err, line))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecuteExitCode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	good := write("good.x", "#!/usr/bin/env xlang\nvar a=1\na=a+1\n")
+	bad := write("bad.x", "var a=\n")
+	panics := write("div.x", "var a=1/0\n")
+	empty := write("empty.x", "")
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"check", good}, exitOK},
+		{[]string{"check", bad}, exitSyntax},
+		{[]string{"run", good}, exitOK},
+		{[]string{good, "arg"}, exitOK},
+		{[]string{"run", panics}, exitRuntime},
+		{[]string{"run", empty}, exitOK},
+		{[]string{"run"}, exitUsage},
+		{[]string{"disasm", filepath.Join(dir, "missing.x")}, exitUsage},
+	}
+	for _, tt := range tests {
+		if got := execute(tt.args); got != tt.want {
+			t.Errorf("execute(%v) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLineTail(t *testing.T) {
+	var tail lineTail
+	for i := 1; i <= tailLines+10; i++ {
+		fmt.Fprintf(&tail, "line %d\n", i)
+	}
+	tail.Write([]byte("last"))
+	tests := []struct {
+		n    int
+		want string
+		ok   bool
+	}{
+		{0, "", false},
+		{10, "", false},
+		{11, "line 11", true},
+		{tailLines + 10, fmt.Sprintf("line %d", tailLines+10), true},
+		{tailLines + 11, "last", true},
+		{tailLines + 12, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := tail.line(tt.n); got != tt.want || ok != tt.ok {
+			t.Errorf("line(%d) = %q, %v, want %q, %v", tt.n, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -20,16 +20,21 @@ var Definitions = map[Opcode]Definition{
 	OpSub:          {"OpSub", []int{}},
 	OpMul:          {"OpMul", []int{}},
 	OpDiv:          {"OpDiv", []int{}},
+	OpFloorDiv:     {"OpFloorDiv", []int{}},
 	OpMinus:        {"OpMinus", []int{}},
 	OpPlus:         {"OpPlus", []int{}},
 	OpMod:          {"OpMod", []int{}},
 	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShl:          {"OpShl", []int{}},
+	OpShr:          {"OpShr", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
 	OpEqual:        {"OpEqual", []int{}},
 	OpNotEQ:        {"OpNotEQ", []int{}},
 	OpGT:           {"OpGT", []int{}},
 	OpGTEq:         {"OpGTEq", []int{}},
-	OpAnd:          {"OpAnd", []int{}},
-	OpOr:           {"OpOr", []int{}},
 	OpNot:          {"OpNot", []int{}},
 	OpTrue:         {"OpTrue", []int{}},
 	OpFalse:        {"OpFalse", []int{}},
@@ -50,9 +55,30 @@ var Definitions = map[Opcode]Definition{
 	OpMakeMap:      {"OpMakeMap", []int{2}},
 	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
 	OpCallFunc:     {"OpCallFunc", []int{1}},
+	OpCallKw:       {"OpCallKw", []int{1, 2}},
+	OpCallSpread:   {"OpCallSpread", []int{1, 2}},
 	OpCallMethod:   {"OpCallMethod", []int{1}},
 	OpLoadMethod:   {"OpLoadMethod", []int{2}},
-	OpClosure:      {"OpClosure", []int{1}},
+	OpClosure:      {"OpClosure", []int{2}},
+	OpDefaults:     {"OpDefaults", []int{1}},
+	OpConcat:       {"OpConcat", []int{2}},
+	OpFormat:       {"OpFormat", []int{2}},
+	OpGetIter:      {"OpGetIter", []int{}},
+	OpIterNext:     {"OpIterNext", []int{2, 1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpUnpack:       {"OpUnpack", []int{1}},
+
+	// and/or 短路求值, 结果已经确定时保留左操作数并跳过右边, 否则弹出它继续求值右边
+	OpJumpIfFalseOrPop: {"OpJumpIfFalseOrPop", []int{2}},
+	OpJumpIfTrueOrPop:  {"OpJumpIfTrueOrPop", []int{2}},
+
+	OpContains: {"OpContains", []int{}},
+	// 用来复制和调整栈顶的操作数, OpRot n 把栈顶的值移到下面第 n 个位置
+	OpDup:  {"OpDup", []int{}},
+	OpDup2: {"OpDup2", []int{}},
+	OpSwap: {"OpSwap", []int{}},
+	OpRot:  {"OpRot", []int{1}},
 }
 
 func Make(op Opcode, operand ...int) []byte {
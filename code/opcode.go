@@ -16,22 +16,29 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpFloorDiv
 	OpMod
 	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShl
+	OpShr
 	OpGT
 	OpGTEq
 	OpEqual
 	OpNotEQ
 
-	OpAnd
-	OpOr
 	OpNot
 
 	OpMinus
 	OpPlus
+	OpBitNot
 
 	OpJump
 	OpJumpNotTrue
+	OpJumpIfFalseOrPop
+	OpJumpIfTrueOrPop
 
 	OpNull
 
@@ -54,7 +61,27 @@ const (
 	OpIndex
 
 	OpCallFunc
+	OpCallKw
+	OpCallSpread
 	OpLoadMethod
 	OpCallMethod
 	OpClosure
+	OpDefaults
+
+	OpConcat
+	OpFormat
+
+	OpGetIter
+	OpIterNext
+
+	OpGetFree
+	OpSetFree
+
+	OpUnpack
+
+	OpContains
+	OpDup
+	OpDup2
+	OpSwap
+	OpRot
 )
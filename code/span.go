@@ -0,0 +1,48 @@
+package code
+
+import (
+	"Interpreter/tokens"
+	"sort"
+)
+
+// SpanEntry 表示从 Pos 开始的指令由源码中的 Span 生成
+type SpanEntry struct {
+	Pos  int
+	Span tokens.Span
+}
+
+// SpanTable 按指令位置升序记录指令对应的源码区间, 运行时错误用它标出位置
+type SpanTable []SpanEntry
+
+// Add 记录从 pos 开始的指令对应 span, 与上一条记录相同时不再记录
+func (t SpanTable) Add(pos int, span tokens.Span) SpanTable {
+	if n := len(t); n > 0 {
+		if t[n-1].Span == span {
+			return t
+		}
+		if t[n-1].Pos == pos {
+			t[n-1].Span = span
+			return t
+		}
+	}
+	return append(t, SpanEntry{Pos: pos, Span: span})
+}
+
+// Truncate 丢弃从 pos 开始的记录, 在删除末尾的指令之后调用
+func (t SpanTable) Truncate(pos int) SpanTable {
+	for len(t) > 0 && t[len(t)-1].Pos >= pos {
+		t = t[:len(t)-1]
+	}
+	return t
+}
+
+// Find 返回 pos 处的指令对应的源码区间
+func (t SpanTable) Find(pos int) (tokens.Span, bool) {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].Pos > pos
+	})
+	if i == 0 || t[i-1].Span == (tokens.Span{}) {
+		return tokens.Span{}, false
+	}
+	return t[i-1].Span, true
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 type Compiler struct {
@@ -22,7 +23,10 @@ type Compiler struct {
 	scopeIdx    int
 	symTable    *parser.SymTable
 	interpreter bool
-	tmpOpPos    []InsPosInfo
+	// statement 表示正在编译的表达式是一条表达式语句本身, if 和循环只能出现在这里
+	statement bool
+	// span 是正在编译的节点在源码中的区间, 记录到它生成的指令上
+	span tokens.Span
 }
 
 func NewScope() CompilationScope {
@@ -43,10 +47,21 @@ func NewCompiler() *Compiler {
 		constants: NewConstTable(),
 		scope:     []CompilationScope{rootScope},
 		scopeIdx:  0,
-		tmpOpPos:  []InsPosInfo{},
 	}
 }
 
+// NewCompilerWithState 复用已有的符号表和常量表, 用于交互模式
+func NewCompilerWithState(table *parser.SymTable, constants *ConstTable) *Compiler {
+	c := NewCompiler()
+	c.constants = constants
+	c.SetSymbol(table)
+	return c
+}
+
+func (c *Compiler) Constants() *ConstTable {
+	return c.constants
+}
+
 func (c *Compiler) SetMode() {
 	c.interpreter = !c.interpreter
 }
@@ -70,6 +85,17 @@ func (c *Compiler) Debug() {
 }
 
 func (c *Compiler) compile(node ast.Node, optimize bool) {
+	if node == nil {
+		c.NewError("invalid syntax: missing expression.")
+		return
+	}
+	statement := c.statement
+	c.statement = false
+	if span := node.Span(); span != (tokens.Span{}) {
+		outer := c.span
+		c.span = span
+		defer func() { c.span = outer }()
+	}
 	switch node := node.(type) {
 	case ast.Program:
 		for _, s := range node.Statements {
@@ -80,9 +106,16 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 			c.compile(s, optimize)
 		}
 	case ast.ExprStatement:
+		c.statement = true
 		c.compile(node.Expression, optimize)
+		if hasValue(node.Expression) {
+			c.emit(code.OpPop)
+		}
 	case ast.FuncStatement:
 		c.compile(node.Expression, optimize)
+		if hasValue(node.Expression) {
+			c.emit(code.OpPop)
+		}
 	case ast.IntNode:
 		numObj := object.Int{Value: node.Value}
 		consIdx := c.constants.AddObj(numObj)
@@ -95,6 +128,15 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 		strObj := object.String{Value: []rune(node.Value)}
 		consIdx := c.constants.AddObj(strObj)
 		c.emit(code.OpConstant, consIdx)
+	case ast.FString:
+		for i, part := range node.Parts {
+			c.compile(part, optimize)
+			if node.Specs[i] != "" {
+				specIdx := c.constants.AddObj(object.String{Value: []rune(node.Specs[i])})
+				c.emit(code.OpFormat, specIdx)
+			}
+		}
+		c.emit(code.OpConcat, len(node.Parts))
 	case ast.BooleanNode:
 		value := node.Value
 		if value {
@@ -113,6 +155,8 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 			c.emit(code.OpMinus)
 		case tokens.Not:
 			c.emit(code.OpNot)
+		case tokens.BitNot:
+			c.emit(code.OpBitNot)
 		default:
 			c.NewErrorF("unknown operator %s", node.Op.Str())
 		}
@@ -130,128 +174,167 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 				c.NewErrorF("unsupported op %s", node.Op.Str())
 			}
 			return
-		case tokens.IPlus, tokens.IMinus, tokens.IMul, tokens.IDiv, tokens.IMod, tokens.IPow:
+		case tokens.NotIn:
+			c.compile(node.Left, optimize)
+			c.compile(node.Right, optimize)
+			c.emitCompare(node.Op)
+			return
+		case tokens.And, tokens.Or:
+			// 短路求值, 结果为决定真假的那个操作数
+			c.compile(node.Left, optimize)
+			jump := code.OpJumpIfFalseOrPop
+			if node.Op.Type == tokens.Or {
+				jump = code.OpJumpIfTrueOrPop
+			}
+			jumpPos := c.emit(jump, 9999)
+			c.compile(node.Right, optimize)
+			c.changeOperand(jumpPos, len(c.curInstruction()))
+			return
+		}
+		if bin, ok := tokens.Compound[node.Op.Type]; ok {
 			ident := node.Left
 			s, ok := c.symTable.Resolve(ident.TokenLiteral())
 			if !ok {
-				c.NewErrorF("Identifier %s was not defined", s.Name)
+				c.NewErrorF("Identifier %s was not defined%s", strconv.Quote(ident.TokenLiteral()), at(ident))
 			}
 			c.compile(node.Left, optimize)
 			c.compile(node.Right, optimize)
-			switch node.Op.Type {
-			case tokens.IPlus:
-				c.emit(code.OpAdd)
-			case tokens.IMinus:
-				c.emit(code.OpSub)
-			case tokens.IMul:
-				c.emit(code.OpMul)
-			case tokens.IDiv:
-				c.emit(code.OpDiv)
-			case tokens.IPow:
-				c.emit(code.OpPow)
-			case tokens.IMod:
-				c.emit(code.OpMod)
-			}
+			c.emit(binaryOps[bin])
 			c.setScope(s)
-		default:
-			c.compile(node.Left, optimize)
-			c.compile(node.Right, optimize)
-			switch node.Op.Type {
-			case tokens.Plus:
-				c.emit(code.OpAdd)
-			case tokens.Minus:
-				c.emit(code.OpSub)
-			case tokens.Mul:
-				c.emit(code.OpMul)
-			case tokens.Div:
-				c.emit(code.OpDiv)
-			case tokens.Mod:
-				c.emit(code.OpMod)
-			case tokens.Pow:
-				c.emit(code.OpPow)
-			case tokens.GT:
-				c.emit(code.OpGT)
-			case tokens.GTEq:
-				c.emit(code.OpGTEq)
-			case tokens.Equal:
-				c.emit(code.OpEqual)
-			case tokens.NotEq:
-				c.emit(code.OpNotEQ)
-			case tokens.And:
-				c.emit(code.OpAnd)
-			case tokens.Or:
-				c.emit(code.OpOr)
-			default:
-				c.NewErrorF("unknown operator %s", node.Op.Str())
-			}
+			return
 		}
+		c.compile(node.Left, optimize)
+		c.compile(node.Right, optimize)
+		op, ok := binaryOps[node.Op.Type]
+		if !ok {
+			c.NewErrorF("unknown operator %s", node.Op.Str())
+			return
+		}
+		c.emit(op)
 	case ast.IfExpression:
+		if !statement {
+			c.NewErrorF("if block does not produce a value, use \"a if cond else b\" instead%s", at(node))
+			return
+		}
+		// else if 链展开为一串条件跳转, 所有分支结束后跳到链尾
+		var endJumps []int
+		for branch := &node; branch != nil; branch = branch.ElseIf {
+			c.compile(branch.Condition, optimize)
+			jumpNotTruePos := c.emit(code.OpJumpNotTrue, 9999)
+			c.compile(branch.Consequence, optimize)
+			// 最后一个分支后面没有其他代码, 不需要跳过
+			if branch.ElseIf != nil || branch.Alternative != nil {
+				endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+			}
+			c.changeOperand(jumpNotTruePos, len(c.curInstruction()))
+			if branch.Alternative != nil {
+				c.compile(branch.Alternative, optimize)
+			}
+		}
+		afterAlterPos := len(c.curInstruction())
+		for _, pos := range endJumps {
+			c.changeOperand(pos, afterAlterPos)
+		}
+		c.markLabel()
+	case ast.CompareChain:
+		// 中间的操作数复制一份留在栈上给下一次比较, 任何一次比较不成立时结果为 false
+		c.compile(node.Operands[0], optimize)
+		var failJumps []int
+		last := len(node.Ops) - 1
+		for i, op := range node.Ops[:last] {
+			c.compile(node.Operands[i+1], optimize)
+			c.emit(code.OpDup)
+			c.emit(code.OpRot, 3)
+			c.emitCompare(op)
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTrue, 9999))
+		}
+		c.compile(node.Operands[last+1], optimize)
+		c.emitCompare(node.Ops[last])
+		endPos := c.emit(code.OpJump, 9999)
+		for _, pos := range failJumps {
+			c.changeOperand(pos, len(c.curInstruction()))
+		}
+		c.emit(code.OpPop)
+		c.emit(code.OpFalse)
+		c.changeOperand(endPos, len(c.curInstruction()))
+	case ast.ConditionalExpr:
 		c.compile(node.Condition, optimize)
 		jumpNotTruePos := c.emit(code.OpJumpNotTrue, 9999)
 		c.compile(node.Consequence, optimize)
 		jumpPos := c.emit(code.OpJump, 9999)
-		afterConSeqPos := len(c.curInstruction())
-		c.changeOperand(jumpNotTruePos, afterConSeqPos)
-		if node.Alternative != nil {
-			c.compile(node.Alternative, optimize)
-			c.emit(code.OpPop)
-		}
-		afterAlterPos := len(c.curInstruction())
-		c.changeOperand(jumpPos, afterAlterPos)
+		c.changeOperand(jumpNotTruePos, len(c.curInstruction()))
+		c.compile(node.Alternative, optimize)
+		c.changeOperand(jumpPos, len(c.curInstruction()))
 	case ast.ForExpression:
+		if !statement {
+			c.NewErrorF("for loop does not produce a value%s", at(node))
+			return
+		}
 		if node.InitCond != nil {
 			c.compile(node.InitCond, false)
 		}
 		forStartPos := len(c.curInstruction())
-		c.compile(node.Condition, false)
+		if node.Condition != nil {
+			c.compile(node.Condition, false)
+		} else {
+			c.emit(code.OpTrue)
+		}
 		breakPos := c.emit(code.OpJumpNotTrue, 9999)
+		c.enterLoop(node.Label, false)
 		c.compile(node.Loop, true)
+		// continue 跳到每轮的更新语句
+		continuePos := len(c.curInstruction())
 		if node.EachOperate != nil {
 			c.compile(node.EachOperate, false)
 		}
 		c.emit(code.OpJump, forStartPos)
 		forEndPos := len(c.curInstruction())
 		c.changeOperand(breakPos, forEndPos)
-		for _, point := range c.tmpOpPos {
-			if point.PType == BreakPoint {
-				c.changeOperand(point.Pos, forEndPos)
-			}
-			if point.PType == LoopStart {
-				c.changeOperand(point.Pos, forStartPos)
-			}
-		}
-		c.tmpOpPos = append(c.tmpOpPos[:0])
+		c.leaveLoop(forEndPos, continuePos)
 		c.emit(code.OpNull)
 		c.emit(code.OpPop)
-	case ast.BreakExpr:
-		pos := c.emit(code.OpJump, 9999)
-		posInfo := InsPosInfo{
-			Pos:   pos,
-			PType: BreakPoint,
+	case ast.ForInExpression:
+		if !statement {
+			c.NewErrorF("for loop does not produce a value%s", at(node))
+			return
 		}
-		c.tmpOpPos = append(c.tmpOpPos, posInfo)
-	case ast.MethodCall:
-		c.compile(node.Left, optimize)
-		for i, method := range node.Methods {
-			c.compile(method, optimize)
-			for _, args := range node.Arguments[i] {
-				c.compile(args, optimize)
-			}
-			c.emit(code.OpCallMethod, len(node.Arguments[i]))
-			if reflect.TypeOf(node.Left).Name() == "IdentNode" {
-				name := node.Left.(ast.IdentNode).Value
-				s, ok := c.symTable.Resolve(name)
-				if !ok {
-					c.NewErrorF("node name %s can't found.", name)
-				}
-				c.setScope(s)
-			} else {
-				c.emit(code.OpPop)
+		c.compile(node.Iterable, optimize)
+		c.emit(code.OpGetIter)
+		forStartPos := len(c.curInstruction())
+		vars := []ast.IdentNode{node.Value}
+		if node.Key != nil {
+			vars = append(vars, *node.Key)
+		}
+		c.enterLoop(node.Label, true)
+		nextPos := c.emit(code.OpIterNext, 9999, len(vars))
+		// 栈顶是 value, 其下是 key
+		for _, v := range vars {
+			s, ok := c.symTable.Resolve(v.Value)
+			if !ok {
+				c.NewErrorF("undefined variable %s%s", strconv.Quote(v.Value), at(v))
 			}
+			c.setScope(s)
 		}
-	case ast.MethodCallStmt:
-		c.compile(node.Call, optimize)
-		c.emit(code.OpPop)
+		c.compile(node.Loop, true)
+		c.emit(code.OpJump, forStartPos)
+		// 循环结束和 break 都跳到这里弹出迭代器
+		forEndPos := c.emit(code.OpPop)
+		c.replaceIns(nextPos, code.Make(code.OpIterNext, forEndPos, len(vars)))
+		c.leaveLoop(forEndPos, forStartPos)
+	case ast.BreakExpr:
+		c.jumpOut(node, node.Label, BreakPoint)
+	case ast.ContinueExpr:
+		c.jumpOut(node, node.Label, ContinuePoint)
+	case ast.MethodCall:
+		// 方法返回更新后的接收者和返回值, 接收者写回它原来的位置, 表达式的值是返回值
+		c.loadTarget(node.Left, optimize)
+		c.compile(node.Method, optimize)
+		for _, arg := range node.Arguments {
+			c.compile(arg, optimize)
+		}
+		c.emit(code.OpCallMethod, len(node.Arguments))
+		c.emit(code.OpRot, targetDepth(node.Left)+2)
+		c.storeTarget(node.Left)
 	case ast.MethodNode:
 		s, ok := c.symTable.Methods.FindIdx(node.Value)
 		if !ok {
@@ -262,38 +345,40 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 		c.compile(node.Value, optimize)
 		s, ok := c.symTable.Resolve(node.Indent.Value)
 		if !ok {
-			c.NewErrorF("undefined variable %s.", strconv.Quote(node.Indent.Value))
+			c.NewErrorF("undefined variable %s%s", strconv.Quote(node.Indent.Value), at(node.Indent))
 		}
 		c.setScope(s)
-	case ast.VarMethodCall:
-		c.compile(node.Value, optimize)
-		if c.isLastIns(code.OpPop) {
-			c.removeLastOp()
+	case ast.UnpackAssign:
+		if len(node.Values) == 1 {
+			c.compile(node.Values[0], optimize)
+			if len(node.Targets) == 1 {
+				c.assignTarget(node.Targets[0])
+			} else {
+				c.unpack(node.Targets)
+			}
+			break
 		}
-		s, ok := c.symTable.Resolve(node.Indent.Value)
-		if !ok {
-			c.NewErrorF("undefined variable %s.", strconv.Quote(node.Indent.Value))
+		if len(node.Values) != len(node.Targets) {
+			c.NewErrorF("cannot assign %d values to %d targets%s", len(node.Values), len(node.Targets), at(node))
+		}
+		// 先求出全部的值再赋值, 因此 a, b = b, a 可以交换变量
+		for _, v := range node.Values {
+			c.compile(v, optimize)
+		}
+		for i := len(node.Targets) - 1; i >= 0; i-- {
+			c.assignTarget(node.Targets[i])
 		}
-		c.setScope(s)
 	case ast.IdentNode:
 		s, ok := c.symTable.Resolve(node.Value)
 		if !ok {
-			c.NewErrorF("undefined Identifier %s.", strconv.Quote(node.Str()))
-		}
-		if s.Type == parser.F && s.ScopeType != parser.BuiltIn {
-			idx, ok := c.constants.Find(s.Name)
-			if !ok {
-				c.NewErrorF("undefined func %s.", strconv.Quote(node.Value))
-			}
-			c.emit(code.OpClosure, idx)
-		} else {
-			c.getScope(s, optimize)
+			c.NewErrorF("undefined Identifier %s%s", strconv.Quote(node.Str()), at(node))
 		}
+		c.getScope(s, optimize)
 	case ast.AssignStatement:
 		c.compile(node.Statement, optimize)
 		s, ok := c.symTable.Resolve(node.Identifier.Value)
 		if !ok {
-			c.NewErrorF("variable %s is undefined but used.", strconv.Quote(node.Identifier.Value))
+			c.NewErrorF("variable %s is undefined but used%s", strconv.Quote(node.Identifier.Value), at(node.Identifier))
 		} else {
 			c.setScope(s)
 		}
@@ -303,7 +388,7 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 		paramsCount := len(node.Parameters)
 		fnIdx := c.constants.RegFunc(node.Name, paramsCount)
 		c.compile(node.FuncBody, optimize)
-		if c.isLastIns(code.OpPop) {
+		if endsWithValue(node.FuncBody.Statements) && c.isLastIns(code.OpPop) {
 			c.replaceLast(code.OpReturnVal)
 		}
 		if !c.isLastIns(code.OpReturnVal) {
@@ -311,19 +396,46 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 			c.emit(code.OpReturnVal)
 		}
 		numLocals := c.symTable.NumDefinitions()
+		freeVars := make([]object.FreeVar, len(c.symTable.FreeSymbols))
+		for i, s := range c.symTable.FreeSymbols {
+			freeVars[i] = object.FreeVar{Local: s.ScopeType == parser.Local, Index: s.Id}
+		}
+		spans := c.curScope().spans
 		instructions := c.leaveScope()
+		c.symTable = c.symTable.Outer
 
+		paramNames := make([]string, paramsCount)
+		for i, p := range node.Parameters {
+			paramNames[i] = p.Value
+		}
 		compiledFn := object.CompiledFunc{
 			FnName:        node.Name,
 			Instructions:  instructions,
+			Spans:         spans,
 			LocalsNum:     numLocals,
 			ParametersNum: paramsCount,
 			LineLoc:       node.Token.Loc.Line,
+			ParamNames:    paramNames,
+			Variadic:      node.Rest != nil,
+			FreeVars:      freeVars,
 		}
 		err := c.constants.AddFunc(fnIdx, compiledFn)
 		if err != nil {
 			c.Push(err)
 		}
+		// 在定义处创建函数对象并求出默认值, 具名函数保存在它的变量槽位中
+		c.emit(code.OpClosure, fnIdx)
+		if len(node.Defaults) > 0 {
+			for _, d := range node.Defaults {
+				c.compile(d, optimize)
+			}
+			c.emit(code.OpDefaults, len(node.Defaults))
+		}
+		if !node.Anonymous {
+			if s, ok := c.symTable.Resolve(node.Name); ok {
+				c.setScope(s)
+			}
+		}
 	case ast.ReturnStatement:
 		if node.ReturnVal != nil {
 			c.compile(node.ReturnVal, optimize)
@@ -359,10 +471,23 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 		c.emit(code.OpIndex)
 	case ast.FuncCallExpr:
 		c.compile(node.Function, optimize)
-		for _, arg := range node.Arguments {
-			c.compile(arg, optimize)
+		segments := c.compileArgs(node.Arguments, optimize)
+		if segments < 0 && len(node.Keywords) == 0 {
+			c.emit(code.OpCallFunc, len(node.Arguments))
+			break
+		}
+		// 关键字参数的名称作为一个数组常量, 与参数值的顺序一致
+		names := make([]object.Object, len(node.Keywords))
+		for i, kw := range node.Keywords {
+			c.compile(kw.Value, optimize)
+			names[i] = object.String{Value: []rune(kw.Name.Value)}
+		}
+		namesIdx := c.constants.AddObj(object.Array{Elements: names})
+		if segments < 0 {
+			c.emit(code.OpCallKw, len(node.Arguments)+len(node.Keywords), namesIdx)
+		} else {
+			c.emit(code.OpCallSpread, segments, namesIdx)
 		}
-		c.emit(code.OpCallFunc, len(node.Arguments))
 	case ast.Map:
 		for i := 0; i < len(node.Keys); i++ {
 			c.compile(node.Keys[i], optimize)
@@ -370,12 +495,18 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 		}
 		c.emit(code.OpMakeMap, len(node.Keys)*2)
 	case ast.ExpressionAssign:
-		c.compile(node.New, optimize)
-		c.compile(node.Old, optimize)
+		c.loadTarget(node.Old, optimize)
 		c.compile(node.Key, optimize)
+		if node.Op != nil {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+			c.compile(node.New, optimize)
+			c.emit(binaryOps[tokens.Compound[node.Op.Type]])
+		} else {
+			c.compile(node.New, optimize)
+		}
 		c.emit(code.OpUpdate)
-		s, _ := c.symTable.Resolve(node.Old.TokenLiteral())
-		c.setScope(s)
+		c.storeTarget(node.Old)
 	default:
 		c.NewErrorF("unknown ast type %s.", reflect.TypeOf(node).String())
 	}
@@ -383,17 +514,16 @@ func (c *Compiler) compile(node ast.Node, optimize bool) {
 
 func (c *Compiler) Compile(node ast.Node) {
 	c.compile(node, true)
-	c.handleNoCall()
+	if program, ok := node.(ast.Program); ok {
+		c.handleNoCall(program.Statements)
+	}
 	//need optimize
 }
 
-func (c *Compiler) handleNoCall() {
-	if c.interpreter {
-		if c.isLastIns(code.OpPop) {
-			c.replaceLast(code.OpPrintTop)
-		} else {
-			c.emit(code.OpPrintTop)
-		}
+// handleNoCall 交互模式下输出最后一条表达式语句的值
+func (c *Compiler) handleNoCall(stmts []ast.Statement) {
+	if c.interpreter && endsWithValue(stmts) && c.isLastIns(code.OpPop) {
+		c.replaceLast(code.OpPrintTop)
 	}
 }
 
@@ -401,6 +531,7 @@ func (c *Compiler) emit(op code.Opcode, operand ...int) int {
 	ins := code.Make(op, operand...)
 	pos := len(c.curInstruction())
 	c.scope[c.scopeIdx].instructions = append(c.curInstruction(), ins...)
+	c.scope[c.scopeIdx].spans = c.curScope().spans.Add(pos, c.span)
 	c.setLastIns(op, pos)
 	return pos
 }
@@ -422,12 +553,19 @@ func (c *Compiler) ByteCode() *bytecode.Bytecode {
 	}
 	byCode := &bytecode.Bytecode{
 		Instruction: c.curInstruction(),
+		Spans:       c.curScope().spans,
 		Constants:   c.constants.Store,
 		Symbols:     ct,
 	}
 	return byCode
 }
 
+// markLabel 表示当前位置是跳转目标, 之前的指令不一定在它之前执行, 不再参与 isLastIns 的判断和窥孔优化
+func (c *Compiler) markLabel() {
+	c.scope[c.scopeIdx].prevIns = EmittedIns{}
+	c.scope[c.scopeIdx].lastIns = EmittedIns{}
+}
+
 func (c *Compiler) isLastIns(op code.Opcode) bool {
 	if len(c.curInstruction()) == 0 {
 		return false
@@ -437,6 +575,7 @@ func (c *Compiler) isLastIns(op code.Opcode) bool {
 
 func (c *Compiler) removeLastOp() {
 	c.scope[c.scopeIdx].instructions = c.curInstruction()[:c.curScope().lastIns.offset]
+	c.scope[c.scopeIdx].spans = c.curScope().spans.Truncate(c.curScope().lastIns.offset)
 	c.scope[c.scopeIdx].lastIns = c.curScope().lastIns
 }
 
@@ -452,6 +591,51 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 	c.replaceIns(opPos, newIns)
 }
 
+func (c *Compiler) enterLoop(label string, iter bool) {
+	loop := &LoopScope{Label: label, Iter: iter}
+	c.scope[c.scopeIdx].loops = append(c.scope[c.scopeIdx].loops, loop)
+}
+
+// leaveLoop 回填最内层循环中的 break 和 continue 跳转
+func (c *Compiler) leaveLoop(breakPos, continuePos int) {
+	loops := c.scope[c.scopeIdx].loops
+	for _, point := range loops[len(loops)-1].points {
+		switch point.PType {
+		case BreakPoint:
+			c.changeOperand(point.Pos, breakPos)
+		case ContinuePoint:
+			c.changeOperand(point.Pos, continuePos)
+		}
+	}
+	c.scope[c.scopeIdx].loops = loops[:len(loops)-1]
+}
+
+// jumpOut 编译 break 和 continue, 跨过的 for-in 循环需要先弹出它们的迭代器
+func (c *Compiler) jumpOut(node ast.Node, label *ast.IdentNode, pType PosType) {
+	loops := c.curScope().loops
+	target := len(loops) - 1
+	if label != nil {
+		for target >= 0 && loops[target].Label != label.Value {
+			target--
+		}
+		if target < 0 {
+			c.NewErrorF("undefined loop label %s%s", strconv.Quote(label.Value), at(label))
+			return
+		}
+	}
+	if target < 0 {
+		c.NewErrorF("%s outside loop%s", strconv.Quote(strings.ToLower(node.TokenLiteral())), at(node))
+		return
+	}
+	for _, loop := range loops[target+1:] {
+		if loop.Iter {
+			c.emit(code.OpPop)
+		}
+	}
+	pos := c.emit(code.OpJump, 9999)
+	loops[target].points = append(loops[target].points, InsPosInfo{Pos: pos, PType: pType})
+}
+
 func (c *Compiler) curScope() CompilationScope {
 	return c.scope[c.scopeIdx]
 }
@@ -478,6 +662,133 @@ func (c *Compiler) replaceLast(target code.Opcode) {
 	c.scope[c.scopeIdx].lastIns.op = target
 }
 
+// loadTarget 取得索引赋值或方法调用的目标, 嵌套的索引把外层的容器和下标留在栈上, 供 storeTarget 写回
+func (c *Compiler) loadTarget(target ast.Expression, optimize bool) {
+	if index, ok := indexTarget(target); ok {
+		c.loadTarget(index.Left, optimize)
+		c.compile(index.Index, optimize)
+		c.emit(code.OpDup2)
+		c.emit(code.OpIndex)
+		return
+	}
+	c.compile(target, optimize)
+}
+
+// storeTarget 把栈顶更新后的值逐层写回外层容器, 最后保存到变量, 不能赋值的目标直接丢弃
+func (c *Compiler) storeTarget(target ast.Expression) {
+	if index, ok := indexTarget(target); ok {
+		c.emit(code.OpUpdate)
+		c.storeTarget(index.Left)
+		return
+	}
+	if ident, ok := target.(ast.IdentNode); ok {
+		s, ok := c.symTable.Resolve(ident.Value)
+		if !ok {
+			c.NewErrorF("undefined variable %s%s", strconv.Quote(ident.Value), at(ident))
+			return
+		}
+		if s.ScopeType != parser.BuiltIn {
+			c.setScope(s)
+			return
+		}
+	}
+	c.emit(code.OpPop)
+}
+
+// indexTarget 判断目标是否为可以写回的索引表达式, 切片不能写回
+func indexTarget(target ast.Expression) (ast.IndexExpression, bool) {
+	index, ok := target.(ast.IndexExpression)
+	if !ok {
+		return index, false
+	}
+	_, slice := index.Index.(ast.IndexSlice)
+	return index, !slice
+}
+
+// targetDepth 返回 loadTarget 在目标下面留下的值的个数
+func targetDepth(target ast.Expression) int {
+	if index, ok := indexTarget(target); ok {
+		return targetDepth(index.Left) + 2
+	}
+	return 0
+}
+
+// emitCompare 比较栈顶的两个值, 左操作数在下
+func (c *Compiler) emitCompare(op tokens.Token) {
+	switch op.Type {
+	case tokens.LT:
+		c.emit(code.OpSwap)
+		c.emit(code.OpGT)
+	case tokens.LTEq:
+		c.emit(code.OpSwap)
+		c.emit(code.OpGTEq)
+	case tokens.NotIn:
+		c.emit(code.OpContains)
+		c.emit(code.OpNot)
+	default:
+		c.emit(binaryOps[op.Type])
+	}
+}
+
+// unpack 把栈顶的值解包到各个目标, 解包后最后一个元素位于栈顶, 因此从后往前赋值
+func (c *Compiler) unpack(targets []ast.Expression) {
+	c.emit(code.OpUnpack, len(targets))
+	for i := len(targets) - 1; i >= 0; i-- {
+		c.assignTarget(targets[i])
+	}
+}
+
+// assignTarget 把栈顶的值赋给标识符或嵌套的目标
+func (c *Compiler) assignTarget(target ast.Expression) {
+	switch target := target.(type) {
+	case ast.IdentNode:
+		s, ok := c.symTable.Resolve(target.Value)
+		if !ok {
+			c.NewErrorF("variable %s is undefined but used%s", strconv.Quote(target.Value), at(target))
+			return
+		}
+		c.setScope(s)
+	case ast.Array:
+		c.unpack(target.Elements)
+	}
+}
+
+// compileArgs 编译位置参数, 没有 ...expr 时逐个压栈并返回 -1;
+// 否则相邻的普通参数合并为一个数组, 与展开的数组一起作为若干段压栈, 返回段数
+func (c *Compiler) compileArgs(args []ast.Expression, optimize bool) int {
+	spread := false
+	for _, arg := range args {
+		if _, ok := arg.(ast.SpreadExpr); ok {
+			spread = true
+		}
+	}
+	if !spread {
+		for _, arg := range args {
+			c.compile(arg, optimize)
+		}
+		return -1
+	}
+	segments, plain := 0, 0
+	for _, arg := range args {
+		if s, ok := arg.(ast.SpreadExpr); ok {
+			if plain > 0 {
+				c.emit(code.OpBuildArray, plain)
+				segments, plain = segments+1, 0
+			}
+			c.compile(s.Value, optimize)
+			segments++
+		} else {
+			c.compile(arg, optimize)
+			plain++
+		}
+	}
+	if plain > 0 {
+		c.emit(code.OpBuildArray, plain)
+		segments++
+	}
+	return segments
+}
+
 func (c *Compiler) getScope(s parser.Symbol, optimize bool) {
 	switch s.ScopeType {
 	case parser.Global:
@@ -485,6 +796,7 @@ func (c *Compiler) getScope(s parser.Symbol, optimize bool) {
 			code.ReadUint16(c.scope[c.scopeIdx].instructions[len(c.curInstruction())-2:]) == uint16(s.Id) {
 			opIdx := c.scope[c.scopeIdx].lastIns.offset
 			c.scope[c.scopeIdx].instructions[opIdx] = byte(code.OpUpdateGlobal)
+			c.scope[c.scopeIdx].lastIns.op = code.OpUpdateGlobal
 		} else {
 			c.emit(code.OpGetGlobal, s.Id)
 		}
@@ -493,11 +805,14 @@ func (c *Compiler) getScope(s parser.Symbol, optimize bool) {
 			code.ReadUint16(c.scope[c.scopeIdx].instructions[len(c.curInstruction())-2:]) == uint16(s.Id) {
 			opIdx := c.scope[c.scopeIdx].lastIns.offset
 			c.scope[c.scopeIdx].instructions[opIdx] = byte(code.OpUpdateLocal)
+			c.scope[c.scopeIdx].lastIns.op = code.OpUpdateLocal
 		} else {
 			c.emit(code.OpGetLocal, s.Id)
 		}
 	case parser.BuiltIn:
 		c.emit(code.OpGetBuiltin, s.Id)
+	case parser.Free:
+		c.emit(code.OpGetFree, s.Id)
 	}
 }
 
@@ -507,6 +822,8 @@ func (c *Compiler) setScope(s parser.Symbol) {
 		c.emit(code.OpSetGlobal, s.Id)
 	case parser.Local:
 		c.emit(code.OpSetLocal, s.Id)
+	case parser.Free:
+		c.emit(code.OpSetFree, s.Id)
 	}
 }
 
@@ -517,6 +834,9 @@ type EmittedIns struct {
 
 type CompilationScope struct {
 	instructions code.Instructions
+	spans        code.SpanTable
 	lastIns,
 	prevIns EmittedIns
+	// loops 是当前函数中正在编译的循环, 最内层在最后
+	loops []*LoopScope
 }
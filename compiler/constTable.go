@@ -43,9 +43,10 @@ func (ct *ConstTable) AddObj(obj object.Object) int {
 	return idx
 }
 
+// Find 查找函数常量, 同名函数以最后定义的为准
 func (ct *ConstTable) Find(FnName string) (int, bool) {
-	for i, obj := range ct.Store {
-		fn, ok := obj.(object.CompiledFunc)
+	for i := len(ct.Store) - 1; i >= 0; i-- {
+		fn, ok := ct.Store[i].(object.CompiledFunc)
 		if ok {
 			if fn.FnName == FnName {
 				return i, true
@@ -54,3 +55,12 @@ func (ct *ConstTable) Find(FnName string) (int, bool) {
 	}
 	return -1, false
 }
+
+// Snapshot 记录常量表的当前长度, 调用返回的函数会丢弃之后新增的常量
+func (ct *ConstTable) Snapshot() func() {
+	num := ct.Num
+	return func() {
+		ct.Store = ct.Store[:num]
+		ct.Num = num
+	}
+}
@@ -1,13 +1,82 @@
 package compiler
 
+import (
+	"Interpreter/ast"
+	"Interpreter/code"
+	"Interpreter/tokens"
+	"fmt"
+)
+
 type PosType string
 
 const (
-	LoopStart  PosType = "Loop"
-	BreakPoint PosType = "Break"
+	ContinuePoint PosType = "Continue"
+	BreakPoint    PosType = "Break"
 )
 
 type InsPosInfo struct {
 	Pos   int
 	PType PosType
 }
+
+// LoopScope 是正在编译的一层循环, points 记录其中等待回填的 break 和 continue
+type LoopScope struct {
+	Label string
+	// Iter 表示 for-in 循环, 它的迭代器在循环期间留在栈上
+	Iter   bool
+	points []InsPosInfo
+}
+
+// hasValue 判断表达式语句执行后是否在栈上留下一个值
+func hasValue(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case ast.IfExpression, ast.ForExpression, ast.ForInExpression, ast.BreakExpr, ast.ContinueExpr:
+		return false
+	case ast.FuncDef:
+		return expr.Anonymous
+	case ast.InfixExpr:
+		if _, ok := tokens.Compound[expr.Op.Type]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// endsWithValue 判断语句列表的最后一条语句是否为有值的表达式语句
+func endsWithValue(stmts []ast.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	switch last := stmts[len(stmts)-1].(type) {
+	case ast.ExprStatement:
+		return hasValue(last.Expression)
+	}
+	return false
+}
+
+// at 返回节点在源码中的位置, 附加在错误信息后面
+func at(node ast.Node) string {
+	start := node.Span().Start
+	return fmt.Sprintf(" at col%d, line%d.", start.Column, start.Line)
+}
+
+// binaryOps 记录二元运算符对应的指令, < 和 <= 会交换操作数后使用 OpGT 和 OpGTEq
+var binaryOps = map[string]code.Opcode{
+	tokens.Plus:   code.OpAdd,
+	tokens.Minus:  code.OpSub,
+	tokens.Mul:    code.OpMul,
+	tokens.Div:    code.OpDiv,
+	tokens.FDiv:   code.OpFloorDiv,
+	tokens.Mod:    code.OpMod,
+	tokens.Pow:    code.OpPow,
+	tokens.BitAnd: code.OpBitAnd,
+	tokens.BitOr:  code.OpBitOr,
+	tokens.BitXor: code.OpBitXor,
+	tokens.Shl:    code.OpShl,
+	tokens.Shr:    code.OpShr,
+	tokens.GT:     code.OpGT,
+	tokens.GTEq:   code.OpGTEq,
+	tokens.In:     code.OpContains,
+	tokens.Equal:  code.OpEqual,
+	tokens.NotEq:  code.OpNotEQ,
+}
@@ -0,0 +1,67 @@
+package errors
+
+import (
+	"Interpreter/tokens"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic 是指向源码中一段区间的错误
+type Diagnostic struct {
+	Msg  string
+	Span tokens.Span
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s at col%d, line%d.", d.Msg, d.Span.Start.Column, d.Span.Start.Line)
+}
+
+// Render 返回错误信息, 诊断会附上出错的源码行, 并在下一行用 ^ 标出出错的区间
+func Render(err error, src string) string {
+	lines := strings.Split(src, "\n")
+	return RenderLines(err, func(n int) (string, bool) {
+		if n < 1 || n > len(lines) {
+			return "", false
+		}
+		return lines[n-1], true
+	})
+}
+
+// RenderLines 与 Render 相同, 但通过 line 按行号 (从 1 开始) 取得源码行, 取不到时只返回错误信息
+func RenderLines(err error, line func(n int) (string, bool)) string {
+	d, ok := err.(Diagnostic)
+	if !ok {
+		return err.Error()
+	}
+	start := d.Span.Start
+	src, ok := line(start.Line)
+	if !ok {
+		return err.Error()
+	}
+	text := []rune(strings.TrimRight(src, "\r"))
+	col := start.Column - 1
+	if col < 0 {
+		col = 0
+	}
+	if col > len(text) {
+		col = len(text)
+	}
+	width := 1
+	if d.Span.End.Line == start.Line && d.Span.End.Column > start.Column {
+		width = d.Span.End.Column - start.Column
+	}
+	// 制表符原样保留, 使 ^ 和源码对齐
+	var pad strings.Builder
+	for _, r := range text[:col] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	num := strconv.Itoa(start.Line)
+	gutter := strings.Repeat(" ", len(num))
+	return fmt.Sprintf("%s\n %s | %s\n %s | %s%s", err.Error(), num, string(text), gutter,
+		pad.String(), strings.Repeat("^", width))
+}
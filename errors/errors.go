@@ -24,7 +24,13 @@ func (e *Errors) NewError(errMsg string) {
 	e.errs = append(e.errs, err)
 }
 
+// Push 记录一个错误, 与已有错误相同的会被忽略
 func (e *Errors) Push(err error) {
+	for _, old := range e.errs {
+		if old.Error() == err.Error() {
+			return
+		}
+	}
 	e.errs = append(e.errs, err)
 }
 
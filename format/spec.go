@@ -0,0 +1,262 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// spec 是解析后的格式说明 [[fill]align][sign][#][0][width][,|_][.precision][type]
+type spec struct {
+	fill      rune
+	align     rune
+	sign      rune
+	alt       bool
+	width     int
+	group     rune
+	precision int
+	verb      rune
+}
+
+func parseSpec(s string) (spec, error) {
+	rs := []rune(s)
+	sp := spec{fill: ' ', precision: -1}
+	isAlign := func(r rune) bool {
+		return strings.ContainsRune("<>^=", r)
+	}
+	i := 0
+	if len(rs) >= 2 && isAlign(rs[1]) {
+		sp.fill, sp.align = rs[0], rs[1]
+		i = 2
+	} else if len(rs) >= 1 && isAlign(rs[0]) {
+		sp.align = rs[0]
+		i = 1
+	}
+	if i < len(rs) && strings.ContainsRune("+- ", rs[i]) {
+		sp.sign = rs[i]
+		i++
+	}
+	if i < len(rs) && rs[i] == '#' {
+		sp.alt = true
+		i++
+	}
+	if i < len(rs) && rs[i] == '0' {
+		// 0 等价于用 0 在符号之后填充
+		if sp.align == 0 {
+			sp.fill, sp.align = '0', '='
+		}
+		i++
+	}
+	var err error
+	if sp.width, i, err = number(rs, i); err != nil {
+		return sp, err
+	}
+	if i < len(rs) && (rs[i] == ',' || rs[i] == '_') {
+		sp.group = rs[i]
+		i++
+	}
+	if i < len(rs) && rs[i] == '.' {
+		i++
+		start := i
+		if sp.precision, i, err = number(rs, i); err != nil {
+			return sp, err
+		}
+		if i == start {
+			return sp, fmt.Errorf("format specifier missing precision")
+		}
+	}
+	if i < len(rs) {
+		sp.verb = rs[i]
+		i++
+	}
+	if i != len(rs) {
+		return sp, fmt.Errorf("invalid format specifier %q", s)
+	}
+	return sp, nil
+}
+
+// maxNumber 是宽度和精度的上限, 远小于 Python 的上限, 避免一次分配过多内存
+const maxNumber = 1 << 20
+
+// number 从 rs[i] 开始读取十进制数字, 返回读到的值和之后的位置
+func number(rs []rune, i int) (int, int, error) {
+	n := 0
+	for ; i < len(rs) && '0' <= rs[i] && rs[i] <= '9'; i++ {
+		n = n*10 + int(rs[i]-'0')
+		if n > maxNumber {
+			return 0, i, fmt.Errorf("Too many decimal digits in format string")
+		}
+	}
+	return n, i, nil
+}
+
+// Spec 按照 Python 风格的格式说明格式化 v, v 只能是 int, float64 或 string
+func Spec(v interface{}, s string) (string, error) {
+	sp, err := parseSpec(s)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return sp.str(v)
+	case int:
+		return sp.int(v)
+	case float64:
+		return sp.float(v)
+	}
+	return "", fmt.Errorf("unsupported value %v for format specifier %q", v, s)
+}
+
+func (sp spec) str(v string) (string, error) {
+	if sp.verb != 0 && sp.verb != 's' {
+		return "", fmt.Errorf("unknown format code '%c' for String", sp.verb)
+	}
+	if sp.sign != 0 || sp.alt || sp.group != 0 || sp.align == '=' {
+		return "", fmt.Errorf("sign, '#', grouping and '=' alignment are not allowed for String")
+	}
+	if sp.precision >= 0 && utf8.RuneCountInString(v) > sp.precision {
+		v = string([]rune(v)[:sp.precision])
+	}
+	return sp.pad("", v, '<'), nil
+}
+
+func (sp spec) int(v int) (string, error) {
+	base, prefix := 10, ""
+	switch sp.verb {
+	case 0, 'd':
+	case 'b':
+		base, prefix = 2, "0b"
+	case 'o':
+		base, prefix = 8, "0o"
+	case 'x':
+		base, prefix = 16, "0x"
+	case 'X':
+		base, prefix = 16, "0X"
+	case 'c':
+		if v < 0 || v > unicode.MaxRune {
+			return "", fmt.Errorf("%%c arg not in range(0x110000)")
+		}
+		return sp.pad("", string(rune(v)), '<'), nil
+	case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+		return sp.float(float64(v))
+	default:
+		return "", fmt.Errorf("unknown format code '%c' for Int", sp.verb)
+	}
+	if sp.precision >= 0 {
+		return "", fmt.Errorf("precision not allowed in integer format specifier")
+	}
+	neg := v < 0
+	var digits string
+	if neg {
+		// 取绝对值时避免最小整数溢出
+		digits = strconv.FormatUint(uint64(-(v+1))+1, base)
+	} else {
+		digits = strconv.FormatUint(uint64(v), base)
+	}
+	if sp.verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	if sp.group != 0 {
+		n := 3
+		if base != 10 {
+			n = 4
+		}
+		digits = group(digits, sp.group, n)
+	}
+	if !sp.alt {
+		prefix = ""
+	}
+	return sp.pad(sp.signOf(neg)+prefix, digits, '>'), nil
+}
+
+func (sp spec) float(v float64) (string, error) {
+	prec := sp.precision
+	var body string
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	switch sp.verb {
+	case 0:
+		body = strconv.FormatFloat(v, 'f', prec, 64)
+		if prec < 0 {
+			body = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case 'f', 'F', 'e', 'E':
+		if prec < 0 {
+			prec = 6
+		}
+		body = strconv.FormatFloat(v, byte(sp.verb), prec, 64)
+	case 'g', 'G':
+		if prec < 0 {
+			prec = 6
+		} else if prec == 0 {
+			prec = 1
+		}
+		body = strconv.FormatFloat(v, byte(sp.verb), prec, 64)
+	case '%':
+		if prec < 0 {
+			prec = 6
+		}
+		body = strconv.FormatFloat(v*100, 'f', prec, 64) + "%"
+	default:
+		return "", fmt.Errorf("unknown format code '%c' for Float", sp.verb)
+	}
+	if sp.group != 0 {
+		end := strings.IndexAny(body, ".e%")
+		if end < 0 {
+			end = len(body)
+		}
+		body = group(body[:end], sp.group, 3) + body[end:]
+	}
+	return sp.pad(sp.signOf(neg), body, '>'), nil
+}
+
+func (sp spec) signOf(neg bool) string {
+	switch {
+	case neg:
+		return "-"
+	case sp.sign == '+':
+		return "+"
+	case sp.sign == ' ':
+		return " "
+	}
+	return ""
+}
+
+// pad 按宽度和对齐方式填充, "=" 表示在符号和数字之间填充
+func (sp spec) pad(sign, body string, align rune) string {
+	if sp.align != 0 {
+		align = sp.align
+	}
+	n := sp.width - utf8.RuneCountInString(sign) - utf8.RuneCountInString(body)
+	if n <= 0 {
+		return sign + body
+	}
+	fill := func(n int) string {
+		return strings.Repeat(string(sp.fill), n)
+	}
+	switch align {
+	case '<':
+		return sign + body + fill(n)
+	case '^':
+		return fill(n/2) + sign + body + fill(n-n/2)
+	case '=':
+		return sign + fill(n) + body
+	}
+	return fill(n) + sign + body
+}
+
+// group 从右向左每 n 位插入一个分隔符
+func group(digits string, sep rune, n int) string {
+	var sb strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%n == 0 {
+			sb.WriteRune(sep)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
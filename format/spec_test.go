@@ -0,0 +1,53 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpec(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		spec string
+		want string
+	}{
+		{3.14159, ".2f", "3.14"},
+		{2, ".2f", "2.00"},
+		{-3.5, "+.1f", "-3.5"},
+		{3.5, "+.1f", "+3.5"},
+		{42, "5", "   42"},
+		{42, "<5", "42   "},
+		{42, "^6", "  42  "},
+		{42, "*>6", "****42"},
+		{-42, "06", "-00042"},
+		{255, "x", "ff"},
+		{255, "#X", "0XFF"},
+		{5, "08b", "00000101"},
+		{1234567, ",", "1,234,567"},
+		{1234567.891, ",.2f", "1,234,567.89"},
+		{0.25, ".1%", "25.0%"},
+		{12345.678, ".3e", "1.235e+04"},
+		{"abc", "5", "abc  "},
+		{"abc", ">5", "  abc"},
+		{"abcdef", ".3", "abc"},
+		{65, "c", "A"},
+		{0x10FFFF, "c", "\U0010FFFF"},
+		{1, "1048576", strings.Repeat(" ", 1048575) + "1"},
+	}
+	for _, tt := range tests {
+		got, err := Spec(tt.v, tt.spec)
+		if err != nil || got != tt.want {
+			t.Errorf("Spec(%v, %q) = %q (%v), want %q", tt.v, tt.spec, got, err, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		v    interface{}
+		spec string
+	}{{1, ".2d"}, {"a", "d"}, {1.5, "x"}, {"a", "+"}, {1, "."}, {1, "5q!"},
+		{1, "99999999999999999999"}, {1.5, ".99999999999999999999f"}, {"a", "1048577"},
+		{-1, "c"}, {0x110000, "c"}} {
+		if _, err := Spec(tt.v, tt.spec); err == nil {
+			t.Errorf("Spec(%v, %q): want an error", tt.v, tt.spec)
+		}
+	}
+}
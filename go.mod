@@ -1 +1,3 @@
-module "Interpreter"
\ No newline at end of file
+module Interpreter
+
+go 1.27.1
@@ -3,30 +3,67 @@ package lexer
 import (
 	"Interpreter/errors"
 	"Interpreter/tokens"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
 )
 
+// lookahead 是预读的一个字符及其 UTF-8 字节数
+type lookahead struct {
+	r    rune
+	size int
+}
+
 type Lexer struct {
-	rs  []rune
-	pos int
-	Loc *tokens.Locate
-	cur *Char
+	reader io.RuneReader
+	look   [4]lookahead // 预读的字符, look[0] 为当前字符
+	n      int          // look 中有效的字符个数
+	eof    bool
+	Loc    *tokens.Locate
+	cur    Char
+	keep   bool   // 是否保留 trivia
+	text   []rune // 开启 keep 时记录本次 NextToken 读过的字符
 	*errors.Errors
 }
 
 func NewLexer(text string) *Lexer {
+	return newLexer(strings.NewReader(text))
+}
+
+// NewReaderLexer 从 r 中边读边分析, 只缓冲固定大小的数据, 适合很大的脚本或管道输入
+func NewReaderLexer(r io.Reader) *Lexer {
+	if rr, ok := r.(io.RuneReader); ok {
+		return newLexer(rr)
+	}
+	return newLexer(bufio.NewReader(r))
+}
+
+func newLexer(r io.RuneReader) *Lexer {
 	l := &Lexer{
-		rs:     []rune(text),
+		reader: r,
 		Errors: errors.NewErr(),
 		Loc: &tokens.Locate{
 			Column: 1,
 			Line:   1,
 		},
 	}
-	l.cur = Code(l.rs[l.pos])
+	l.cur = l.at(0)
 	return l
 }
 
-func (l Lexer) Array() []tokens.Token {
+// KeepTrivia 让之后读取的 token 带上原始文本以及前后的空白和注释, 用于格式化等需要还原源码的工具
+func (l *Lexer) KeepTrivia() {
+	l.keep = true
+}
+
+// errorAt 记录从 start 到当前位置的错误
+func (l *Lexer) errorAt(start tokens.Locate, format string, a ...interface{}) {
+	l.Push(errors.Diagnostic{Msg: fmt.Sprintf(format, a...), Span: tokens.Span{Start: start, End: *l.Loc}})
+}
+
+func (l *Lexer) Array() []tokens.Token {
 	var ts []tokens.Token
 	first := l.NextToken()
 	for ; !first.IsEOF(); first = l.NextToken() {
@@ -36,69 +73,245 @@ func (l Lexer) Array() []tokens.Token {
 	return ts
 }
 
+// at 返回当前位置之后第 n 个字符, 不足时从 reader 中补充, 读完后返回 0
+func (l *Lexer) at(n int) Char {
+	for l.n <= n && !l.eof {
+		r, size, err := l.reader.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				l.NewErrorF("read error: %s", err)
+			}
+			l.eof = true
+			break
+		}
+		l.look[l.n] = lookahead{r, size}
+		l.n++
+	}
+	if n < l.n {
+		return Code(l.look[n].r)
+	}
+	return Code(0)
+}
+
+// advance 前进 step 个字符, 同时更新字节偏移、行号和列号
 func (l *Lexer) advance(step int) {
-	l.pos += step
-	l.Loc.Column += step
-	if l.pos >= len(l.rs) {
-		l.cur = Code(0)
-	} else {
-		if l.cur.Equal("\n") {
+	for ; step > 0 && !l.at(0).IsNull(); step-- {
+		c := l.look[0]
+		copy(l.look[:], l.look[1:l.n])
+		l.n--
+		if l.keep {
+			l.text = append(l.text, c.r)
+		}
+		l.Loc.Offset += c.size
+		if c.r == '\n' {
 			l.Loc.Column = 1
 			l.Loc.Line += 1
+		} else {
+			l.Loc.Column += 1
 		}
-		l.cur = Code(l.rs[l.pos])
 	}
+	l.cur = l.at(0)
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.cur.IsWhitespace() && !l.cur.IsNull() {
-		l.advance(1)
+// trivia 跳过空白、# 行注释和 /* */ 块注释, 行注释会连同结尾的换行一起跳过.
+// trailing 为 true 时读到行注释结尾的换行就停止, 剩下的留给下一个 token 作为前导
+func (l *Lexer) trivia(trailing bool) []tokens.Trivia {
+	var res []tokens.Trivia
+	for {
+		start, first := len(l.text), l.cur.Rune()
+		var kind string
+		switch {
+		case l.cur.IsWhitespace():
+			for l.cur.IsWhitespace() {
+				l.advance(1)
+			}
+			kind = tokens.Whitespace
+		case l.cur.Equal("#"):
+			for !l.cur.Equal("\n") && !l.cur.IsNull() {
+				l.advance(1)
+			}
+			kind = tokens.Comment
+		case l.cur.Equal("/") && l.peek().Equal("*"):
+			l.blockComment()
+			kind = tokens.Comment
+		default:
+			return res
+		}
+		if l.keep {
+			res = append(res, tokens.Trivia{Type: kind, Text: string(l.text[start:])})
+		}
+		if first == '#' && l.cur.Equal("\n") {
+			l.advance(1)
+			if l.keep {
+				res = append(res, tokens.Trivia{Type: tokens.Newline, Text: "\n"})
+			}
+			if trailing {
+				return res
+			}
+		}
 	}
 }
 
-func (l *Lexer) skipComment() {
-	for !l.cur.Equal("\n") && !l.cur.IsNull() {
+func (l *Lexer) blockComment() {
+	start := *l.Loc
+	l.advance(2)
+	for !(l.cur.Equal("*") && l.peek().Equal("/")) {
+		if l.cur.IsNull() {
+			l.errorAt(start, "unterminated block comment")
+			return
+		}
 		l.advance(1)
 	}
-	// 跳过\n
-	l.advance(1)
+	l.advance(2)
 }
 
-func (l *Lexer) peek() *Char {
-	peekPos := l.pos + 1
-	if peekPos >= len(l.rs) {
-		return Code(0)
-	} else {
-		return Code(l.rs[peekPos])
-	}
+func (l *Lexer) peek() Char {
+	return l.at(1)
 }
 
-func (l *Lexer) peekN(n int) *Char {
-	peekPos := l.pos + n
-	if peekPos >= len(l.rs) {
-		return Code(0)
-	} else {
-		return Code(l.rs[peekPos])
-	}
+func (l *Lexer) peekN(n int) Char {
+	return l.at(n)
 }
 
+// number 读取数字字面量, 支持 0x/0o/0b 前缀、下划线分隔、小数和指数
 func (l *Lexer) number() *tokens.Token {
+	start := *l.Loc
 	var value []rune
-	for !l.cur.IsNull() && l.cur.IsDigital() {
-		value = append(value, l.cur.Rune())
-		l.advance(1)
+	if l.cur.Equal("0") {
+		if base, name := numberBase(l.peek().Rune()); base != 0 {
+			value = append(value, l.cur.Rune(), l.peek().Rune())
+			l.advance(2)
+			value, ok := l.digits(value, base, true)
+			if len(value) == 2 {
+				return l.badNumber(tokens.Int, start, "invalid %s literal %s: no digits after the prefix",
+					name, string(l.rest(value)))
+			}
+			if !ok {
+				return l.badNumber(tokens.Int, start, "invalid underscore in numeric literal %s", string(l.rest(value)))
+			}
+			return l.numberEnd(tokens.Int, value, name, start)
+		}
+	}
+	kind, ok := tokens.Int, true
+	if l.cur.Equal(".") {
+		value = append(value, '0')
+	} else {
+		value, ok = l.digits(value, 10, false)
 	}
 	if l.cur.Equal(".") {
+		kind = tokens.Float
+		value = append(value, '.')
+		l.advance(1)
+		if l.cur.IsDigital() {
+			var fracOk bool
+			value, fracOk = l.digits(value, 10, false)
+			ok = ok && fracOk
+		}
+	}
+	if l.cur.Equal("e") || l.cur.Equal("E") {
+		kind = tokens.Float
 		value = append(value, l.cur.Rune())
 		l.advance(1)
-		for !l.cur.IsNull() && l.cur.IsDigital() {
+		if l.cur.Equal("+") || l.cur.Equal("-") {
 			value = append(value, l.cur.Rune())
 			l.advance(1)
 		}
-		return tokens.NToken(tokens.Float, string(value), l.Loc)
-	} else {
-		return tokens.NToken(tokens.Int, string(value), l.Loc)
+		n := len(value)
+		var expOk bool
+		value, expOk = l.digits(value, 10, false)
+		if len(value) == n {
+			return l.badNumber(tokens.Float, start, "invalid float literal %s: exponent has no digits",
+				string(l.rest(value)))
+		}
+		ok = ok && expOk
+	}
+	if !ok {
+		return l.badNumber(kind, start, "invalid underscore in numeric literal %s", string(l.rest(value)))
+	}
+	if kind == tokens.Int && len(value) > 1 && value[0] == '0' && strings.Trim(string(value), "0_") != "" {
+		return l.badNumber(tokens.Int, start,
+			"invalid decimal literal %s: leading zeros are not permitted, use 0o for octal", string(value))
+	}
+	if kind == tokens.Float {
+		return l.numberEnd(kind, value, "float", start)
+	}
+	return l.numberEnd(kind, value, "decimal", start)
+}
+
+// numberBase 返回进制前缀对应的进制和名称
+func numberBase(r rune) (int, string) {
+	switch r {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
+	}
+	return 0, ""
+}
+
+// digits 读取指定进制的数字, 下划线只能出现在两个数字之间或紧跟进制前缀, 位置不对时 ok 为 false
+func (l *Lexer) digits(value []rune, base int, afterPrefix bool) (res []rune, ok bool) {
+	ok = true
+	first := true
+	for !l.cur.IsNull() {
+		if l.cur.Equal("_") {
+			if (first && !afterPrefix) || digitValue(l.peek().Rune()) >= base {
+				ok = false
+			}
+			value = append(value, '_')
+			l.advance(1)
+			continue
+		}
+		if digitValue(l.cur.Rune()) >= base {
+			break
+		}
+		value = append(value, l.cur.Rune())
+		l.advance(1)
+		first = false
 	}
+	return value, ok
+}
+
+// rest 读取紧跟在数字后面的字母和数字, 让错误信息包含完整的字面量
+func (l *Lexer) rest(value []rune) []rune {
+	for l.cur.IsAlNum() {
+		value = append(value, l.cur.Rune())
+		l.advance(1)
+	}
+	return value
+}
+
+func digitValue(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r-'a') + 10
+	case 'A' <= r && r <= 'F':
+		return int(r-'A') + 10
+	}
+	return 16
+}
+
+// numberEnd 检查数字后面是否紧跟字母或数字, 例如 0b102 或 12abc
+func (l *Lexer) numberEnd(kind string, value []rune, name string, start tokens.Locate) *tokens.Token {
+	if l.cur.IsAlNum() {
+		c := l.cur.Rune()
+		value = l.rest(value)
+		if '0' <= c && c <= '9' {
+			return l.badNumber(kind, start, "invalid digit '%c' in %s literal %s", c, name, string(value))
+		}
+		return l.badNumber(kind, start, "invalid %s literal %s", name, string(value))
+	}
+	return tokens.NToken(kind, string(value), l.Loc)
+}
+
+// badNumber 记录错误并返回值为 0 的字面量, 避免语法分析阶段重复报错
+func (l *Lexer) badNumber(kind string, start tokens.Locate, format string, a ...interface{}) *tokens.Token {
+	l.errorAt(start, format, a...)
+	return tokens.NToken(kind, "0", l.Loc)
 }
 
 func (l *Lexer) id() *tokens.Token {
@@ -115,37 +328,151 @@ func (l *Lexer) id() *tokens.Token {
 	return t
 }
 
-func (l *Lexer) string(LF string) *tokens.Token {
-	l.advance(1) //skip LF
+// string 读取字符串字面量, 支持 '...', "...", 三引号多行字符串以及 r 前缀的原始字符串
+func (l *Lexer) string(raw bool) *tokens.Token {
+	start := *l.Loc
+	quote := l.cur.Rune()
+	triple := l.peek().Rune() == quote && l.peekN(2).Rune() == quote
+	if triple {
+		l.advance(3)
+	} else {
+		l.advance(1)
+	}
 	var rs []rune
-	for !l.cur.Equal(LF) && !l.cur.IsNull() {
-		rs = append(rs, l.cur.Rune())
+	for {
+		switch {
+		case l.cur.IsNull(), l.cur.Equal("\n") && !triple:
+			l.errorAt(start, "unterminated string literal")
+			return tokens.NToken(tokens.String, string(rs), l.Loc)
+		case l.cur.Rune() == quote:
+			if !triple {
+				l.advance(1)
+				return tokens.NToken(tokens.String, string(rs), l.Loc)
+			}
+			if l.peek().Rune() == quote && l.peekN(2).Rune() == quote {
+				l.advance(3)
+				return tokens.NToken(tokens.String, string(rs), l.Loc)
+			}
+			rs = append(rs, quote)
+			l.advance(1)
+		case l.cur.Equal("\\") && raw:
+			// 原始字符串保留反斜杠, 但 \" 不会结束字符串
+			rs = append(rs, l.cur.Rune())
+			l.advance(1)
+			if !l.cur.IsNull() {
+				rs = append(rs, l.cur.Rune())
+				l.advance(1)
+			}
+		case l.cur.Equal("\\"):
+			rs = l.escape(rs)
+		default:
+			rs = append(rs, l.cur.Rune())
+			l.advance(1)
+		}
+	}
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// escape 处理以反斜杠开头的转义序列, 结果追加到 rs
+func (l *Lexer) escape(rs []rune) []rune {
+	loc := *l.Loc
+	l.advance(1) // skip \
+	c := l.cur.Rune()
+	if r, ok := escapes[c]; ok {
 		l.advance(1)
+		return append(rs, r)
 	}
-	l.advance(1) //skip LF
-	return tokens.NToken(tokens.String, string(rs), l.Loc)
+	switch c {
+	case '\n': // 续行
+		l.advance(1)
+		return rs
+	case 'x', 'u':
+		l.advance(1)
+		width := 2
+		if c == 'u' {
+			width = 4
+		}
+		var value rune
+		for i := 0; i < width; i++ {
+			digit := hexValue(l.cur.Rune())
+			if digit < 0 {
+				l.errorAt(loc, "invalid escape sequence \\%c: want %d hex digits", c, width)
+				return rs
+			}
+			value = value*16 + digit
+			l.advance(1)
+		}
+		if !utf8.ValidRune(value) {
+			l.errorAt(loc, "invalid unicode code point \\%c%0*X", c, width, value)
+			return rs
+		}
+		return append(rs, value)
+	case 0:
+		return rs
+	}
+	l.advance(1)
+	l.errorAt(loc, "invalid escape sequence \\%c", c)
+	return append(rs, '\\', c)
+}
+
+func hexValue(r rune) rune {
+	switch {
+	case '0' <= r && r <= '9':
+		return r - '0'
+	case 'a' <= r && r <= 'f':
+		return r - 'a' + 10
+	case 'A' <= r && r <= 'F':
+		return r - 'A' + 10
+	}
+	return -1
 }
 
 func (l *Lexer) illegal() *tokens.Token {
+	start := *l.Loc
 	var value []rune
-	for !l.cur.IsNull() && !l.cur.IsWhitespace() {
+	// 停在换行之前, 让解析器可以从下一行重新开始
+	for !l.cur.IsNull() && !l.cur.IsWhitespace() && l.cur.Rune() != '\n' {
 		value = append(value, l.cur.Rune())
 		l.advance(1)
 	}
-	l.NewErrorF("Illegal tokens %s at col%d, line%d.",
-		string(value), l.Loc.Column, l.Loc.Line)
+	l.errorAt(start, "Illegal tokens %s", string(value))
 	return tokens.NToken(tokens.Illegal, string(value), l.Loc)
 }
 
+// NextToken 跳过空白和注释后读取下一个 token, 并记录它的起止位置
 func (l *Lexer) NextToken() *tokens.Token {
-LOOP:
-	l.skipWhitespace()
+	l.text = l.text[:0]
+	leading := l.trivia(false)
+	start, pos := *l.Loc, len(l.text)
+	t := l.scan()
+	t.Loc, t.End = start, *l.Loc
+	if l.keep {
+		t.Raw = string(l.text[pos:])
+		t.Leading = leading
+		if !t.IsLF() {
+			t.Trailing = l.trivia(true)
+		}
+	}
+	return t
+}
+
+func (l *Lexer) scan() *tokens.Token {
 	loc := l.Loc
 	switch {
-	case l.cur.Equal("#"):
+	case l.cur.Equal("r") && (l.peek().Equal(`"`) || l.peek().Equal(`'`)):
 		l.advance(1)
-		l.skipComment()
-		goto LOOP
+		return l.string(true)
+	case l.cur.Equal("f") && (l.peek().Equal(`"`) || l.peek().Equal(`'`)):
+		return l.fstring()
 	case l.cur.IsAlpha():
 		return l.id()
 	case l.cur.IsDigital():
@@ -155,6 +482,10 @@ LOOP:
 			l.advance(2)
 			return tokens.NToken(tokens.Equal, "==", loc)
 		}
+		if l.peek().Equal(">") {
+			l.advance(2)
+			return tokens.NToken(tokens.Arrow, "=>", loc)
+		}
 		l.advance(1)
 		return tokens.NToken(tokens.Assign, "=", loc)
 	case l.cur.Equal("!"):
@@ -163,6 +494,14 @@ LOOP:
 			return tokens.NToken(tokens.NotEq, "!=", loc)
 		}
 	case l.cur.Equal("<"):
+		if l.peek().Equal("<") {
+			if l.peekN(2).Equal("=") {
+				l.advance(3)
+				return tokens.NToken(tokens.IShl, "<<=", loc)
+			}
+			l.advance(2)
+			return tokens.NToken(tokens.Shl, "<<", loc)
+		}
 		if l.peek().Equal("=") {
 			l.advance(2)
 			return tokens.NToken(tokens.LTEq, "<=", loc)
@@ -170,6 +509,14 @@ LOOP:
 		l.advance(1)
 		return tokens.NToken(tokens.LT, "<", loc)
 	case l.cur.Equal(">"):
+		if l.peek().Equal(">") {
+			if l.peekN(2).Equal("=") {
+				l.advance(3)
+				return tokens.NToken(tokens.IShr, ">>=", loc)
+			}
+			l.advance(2)
+			return tokens.NToken(tokens.Shr, ">>", loc)
+		}
 		if l.peek().Equal("=") {
 			l.advance(2)
 			return tokens.NToken(tokens.GTEq, ">=", loc)
@@ -212,6 +559,14 @@ LOOP:
 		l.advance(1)
 		return tokens.NToken(tokens.Mul, "*", loc)
 	case l.cur.Equal("/"):
+		if l.peek().Equal("/") {
+			if l.peekN(2).Equal("=") {
+				l.advance(3)
+				return tokens.NToken(tokens.IFDiv, "//=", loc)
+			}
+			l.advance(2)
+			return tokens.NToken(tokens.FDiv, "//", loc)
+		}
 		if l.peek().Equal("=") {
 			l.advance(2)
 			return tokens.NToken(tokens.IDiv, "/=", loc)
@@ -225,8 +580,32 @@ LOOP:
 		}
 		l.advance(1)
 		return tokens.NToken(tokens.Mod, "%", loc)
+	case l.cur.Equal("&"):
+		if l.peek().Equal("=") {
+			l.advance(2)
+			return tokens.NToken(tokens.IBitAnd, "&=", loc)
+		}
+		l.advance(1)
+		return tokens.NToken(tokens.BitAnd, "&", loc)
+	case l.cur.Equal("|"):
+		if l.peek().Equal("=") {
+			l.advance(2)
+			return tokens.NToken(tokens.IBitOr, "|=", loc)
+		}
+		l.advance(1)
+		return tokens.NToken(tokens.BitOr, "|", loc)
+	case l.cur.Equal("^"):
+		if l.peek().Equal("=") {
+			l.advance(2)
+			return tokens.NToken(tokens.IBitXor, "^=", loc)
+		}
+		l.advance(1)
+		return tokens.NToken(tokens.BitXor, "^", loc)
+	case l.cur.Equal("~"):
+		l.advance(1)
+		return tokens.NToken(tokens.BitNot, "~", loc)
 	case l.cur.Equal(`"`), l.cur.Equal(`'`):
-		return l.string(string(l.cur.Rune()))
+		return l.string(false)
 	case l.cur.Equal("("):
 		l.advance(1)
 		return tokens.NToken(tokens.LParen, "(", loc)
@@ -246,15 +625,14 @@ LOOP:
 		l.advance(1)
 		return tokens.NToken(tokens.RBRACE, "}", loc)
 	case l.cur.Equal("."):
-		l.advance(1)
-		if l.cur.IsDigital() {
-			var value = []rune("0.")
-			for !l.cur.IsNull() && l.cur.IsDigital() {
-				value = append(value, l.cur.Rune())
-				l.advance(1)
-			}
-			return tokens.NToken(tokens.Float, string(value), l.Loc)
+		if l.peek().IsDigital() {
+			return l.number()
 		}
+		if l.peek().Equal(".") && l.peekN(2).Equal(".") {
+			l.advance(3)
+			return tokens.NToken(tokens.Ellipsis, "...", loc)
+		}
+		l.advance(1)
 		return tokens.NToken(tokens.Dot, ".", loc)
 	case l.cur.Equal(";"):
 		l.advance(1)
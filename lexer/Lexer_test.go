@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"Interpreter/tokens"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +35,242 @@ if (a==1){
 return a+1}else{
 return abv !=  and  >=  <= ==} [1,2,3]`
 	l := NewLexer(s)
-	fmt.Println(l.Array()[len(l.Array())-1])
+	ts := l.Array()
+	fmt.Println(ts[len(ts)-1])
 	fmt.Println(l.Errs())
 }
+
+func TestLexer_stringLiteral(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`'\t'`, "\t"},
+		{`"中"`, "中"},
+		{`"she said \"hi\""`, `she said "hi"`},
+		{`'it\'s'`, "it's"},
+		{`"\\"`, `\`},
+		{`"\x41\u4e2d"`, "A中"},
+		{`r"c:\new\"x"`, `c:\new\"x`},
+		{"\"\"\"say \"hi\"\nbye\"\"\"", "say \"hi\"\nbye"},
+		{"'''a\\tb'''", "a\tb"},
+		{"\"a\\\nb\"", "ab"},
+	}
+	for _, tt := range tests {
+		l := NewLexer(tt.src)
+		tok := l.NextToken()
+		if l.HasError() {
+			t.Errorf("lex %s: unexpected errors %v", tt.src, l.Errs())
+			continue
+		}
+		if tok.Type != tokens.String || tok.Literal != tt.want {
+			t.Errorf("lex %s = %s %q, want String %q", tt.src, tok.Type, tok.Literal, tt.want)
+		}
+	}
+}
+
+func TestLexer_stringErrors(t *testing.T) {
+	for _, src := range []string{`"abc`, "'abc\n'", `"""abc`, `"\q"`, `"\x4"`, `"\uZZZZ"`} {
+		l := NewLexer(src)
+		l.NextToken()
+		if !l.HasError() {
+			t.Errorf("lex %q: want an error", src)
+		}
+	}
+}
+
+func TestLexer_numberLiteral(t *testing.T) {
+	tests := []struct {
+		src, typ, want string
+	}{
+		{"0xFF", tokens.Int, "0xFF"},
+		{"0b1010", tokens.Int, "0b1010"},
+		{"0o755", tokens.Int, "0o755"},
+		{"1_000_000", tokens.Int, "1_000_000"},
+		{"0x_ff", tokens.Int, "0x_ff"},
+		{"1.5e-3", tokens.Float, "1.5e-3"},
+		{"2E10", tokens.Float, "2E10"},
+		{".5", tokens.Float, "0.5"},
+		{"1.", tokens.Float, "1."},
+		{"00", tokens.Int, "00"},
+	}
+	for _, tt := range tests {
+		l := NewLexer(tt.src)
+		tok := l.NextToken()
+		if l.HasError() {
+			t.Errorf("lex %s: unexpected errors %v", tt.src, l.Errs())
+			continue
+		}
+		if tok.Type != tt.typ || tok.Literal != tt.want {
+			t.Errorf("lex %s = %s %q, want %s %q", tt.src, tok.Type, tok.Literal, tt.typ, tt.want)
+		}
+	}
+}
+
+func TestLexer_numberErrors(t *testing.T) {
+	for _, src := range []string{"0x", "0b", "1e", "1e+", "0b102", "12abc", "0755", "1__0", "1_", "3.x"} {
+		l := NewLexer(src)
+		l.NextToken()
+		if len(l.Errs()) != 1 {
+			t.Errorf("lex %q: want one error, got %v", src, l.Errs())
+		}
+	}
+}
+
+func TestLexer_unicodeIdent(t *testing.T) {
+	l := NewLexer("var 变量_1 = π + naïve٣")
+	want := []string{tokens.Var, "变量_1", tokens.Assign, "π", tokens.Plus, "naïve٣"}
+	for _, w := range want {
+		tok := l.NextToken()
+		if tok.Type != w && tok.Literal != w {
+			t.Errorf("got %s, want %s", tok.Str(), w)
+		}
+	}
+	if l.HasError() {
+		t.Errorf("unexpected errors %v", l.Errs())
+	}
+}
+
+func TestLexer_span(t *testing.T) {
+	l := NewLexer("var 名字 = 12\n  foo(\"a\")")
+	want := []struct {
+		lit               string
+		offset, line, col int
+		endOffset, endCol int
+	}{
+		{tokens.Var, 0, 1, 1, 3, 4},
+		{"名字", 4, 1, 5, 10, 7},
+		{"=", 11, 1, 8, 12, 9},
+		{"12", 13, 1, 10, 15, 12},
+		{"LF", 15, 1, 12, 16, 1},
+		{"foo", 18, 2, 3, 21, 6},
+		{"(", 21, 2, 6, 22, 7},
+		{"a", 22, 2, 7, 25, 10},
+	}
+	for _, w := range want {
+		tok := l.NextToken()
+		if tok.Literal != w.lit || tok.Loc.Offset != w.offset || tok.Loc.Line != w.line ||
+			tok.Loc.Column != w.col || tok.End.Offset != w.endOffset || tok.End.Column != w.endCol {
+			t.Errorf("token %s: got %+v-%+v", w.lit, tok.Loc, tok.End)
+		}
+	}
+}
+
+func TestLexer_trivia(t *testing.T) {
+	src := "# header\n\nvar a = 1  # one\n/* block\n comment */ def f(x) {\n\treturn r\"raw\" + .5 /* tail */\n}\n  # end"
+	l := NewLexer(src)
+	l.KeepTrivia()
+	var sb strings.Builder
+	for {
+		tok := l.NextToken()
+		sb.WriteString(tok.Source())
+		if tok.IsEOF() {
+			break
+		}
+	}
+	if l.HasError() {
+		t.Fatalf("unexpected errors %v", l.Errs())
+	}
+	if sb.String() != src {
+		t.Errorf("reconstructed source differs:\n%q\n%q", sb.String(), src)
+	}
+}
+
+func TestLexer_triviaAttach(t *testing.T) {
+	l := NewLexer("  a = 1 # c\nb")
+	l.KeepTrivia()
+	a := l.NextToken()
+	if len(a.Leading) != 1 || a.Leading[0].Text != "  " || len(a.Trailing) != 1 {
+		t.Errorf("a: leading %v trailing %v", a.Leading, a.Trailing)
+	}
+	l.NextToken()
+	one := l.NextToken()
+	want := []tokens.Trivia{{Type: tokens.Whitespace, Text: " "}, {Type: tokens.Comment, Text: "# c"},
+		{Type: tokens.Newline, Text: "\n"}}
+	if fmt.Sprint(one.Trailing) != fmt.Sprint(want) {
+		t.Errorf("1: trailing %v, want %v", one.Trailing, want)
+	}
+	if b := l.NextToken(); b.Literal != "b" || len(b.Leading) != 0 {
+		t.Errorf("b: %s leading %v", b.Str(), b.Leading)
+	}
+}
+
+func TestLexer_blockComment(t *testing.T) {
+	l := NewLexer("1 /* a\nb */ + 2")
+	var types []string
+	for tok := l.NextToken(); !tok.IsEOF(); tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	if strings.Join(types, " ") != "Int Plus Int" {
+		t.Errorf("got %v", types)
+	}
+	l = NewLexer("1 /* open")
+	l.Array()
+	if !l.HasError() {
+		t.Errorf("unterminated block comment: want an error")
+	}
+}
+
+func TestLexer_empty(t *testing.T) {
+	for _, src := range []string{"", "   ", "# only a comment"} {
+		l := NewLexer(src)
+		if tok := l.NextToken(); !tok.IsEOF() {
+			t.Errorf("lex %q = %s, want EOF", src, tok.Str())
+		}
+	}
+}
+
+func TestNewReaderLexer(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&sb, "var 变量%d = %d * 0x1F # 注释\n", i, i)
+	}
+	src := sb.String()
+	want := NewLexer(src).Array()
+	// MultiReader 不是 io.RuneReader, 会经过 bufio 缓冲
+	got := NewReaderLexer(io.MultiReader(strings.NewReader(src))).Array()
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Literal != want[i].Literal || got[i].Loc != want[i].Loc {
+			t.Fatalf("token %d = %s, want %s", i, got[i].Str(), want[i].Str())
+		}
+	}
+}
+
+func TestLexer_allocs(t *testing.T) {
+	src := "#" + strings.Repeat("comment ", 2000) + "\n" + strings.Repeat(" ", 2000) + "abc"
+	allocs := testing.AllocsPerRun(10, func() {
+		l := NewLexer(src)
+		l.NextToken()
+	})
+	if allocs > 10 {
+		t.Errorf("lexing a long comment allocates %v times, want a constant", allocs)
+	}
+}
+
+func TestLexer_fstring(t *testing.T) {
+	l := NewLexer(`f"total={a + b}, name={user['name']:>8} {{x}}"`)
+	tok := l.NextToken()
+	if l.HasError() {
+		t.Fatalf("unexpected errors %v", l.Errs())
+	}
+	want := []tokens.FPart{
+		{Text: "total="},
+		{Text: "a + b", Expr: true, Loc: tokens.Locate{Offset: 9, Column: 10, Line: 1}},
+		{Text: ", name="},
+		{Text: "user['name']", Expr: true, Spec: ">8", Loc: tokens.Locate{Offset: 23, Column: 24, Line: 1}},
+		{Text: " {x}"},
+	}
+	if tok.Type != tokens.FString || fmt.Sprint(tok.Parts) != fmt.Sprint(want) {
+		t.Errorf("got %s %v, want %v", tok.Type, tok.Parts, want)
+	}
+	for _, src := range []string{`f"{}"`, `f"{a"`, `f"a}"`, `f"{a`, `f"{'x}"`} {
+		l := NewLexer(src)
+		l.NextToken()
+		if !l.HasError() {
+			t.Errorf("lex %q: want an error", src)
+		}
+	}
+}
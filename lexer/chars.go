@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"strconv"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -9,15 +10,15 @@ type Char struct {
 	id int32
 }
 
-func Code(r rune) *Char {
-	return &Char{r}
+func Code(r rune) Char {
+	return Char{r}
 }
 
-func (c *Char) IsNull() bool {
+func (c Char) IsNull() bool {
 	return c.id == 0
 }
 
-func (c *Char) IsWhitespace() bool {
+func (c Char) IsWhitespace() bool {
 	switch c.id {
 	case '\t', '\v', '\f', '\r', ' ', 0x85, 0xA0: // use \n as LF
 		return true
@@ -25,21 +26,22 @@ func (c *Char) IsWhitespace() bool {
 	return false
 }
 
-func (c *Char) IsDigital() bool {
+func (c Char) IsDigital() bool {
 	return 47 < c.id && c.id < 58
 }
 
-func (c *Char) IsAlpha() bool {
-	return (64 < c.id && c.id < 91) || (96 < c.id && c.id < 123) || c.id == 95
+// IsAlpha 判断是否可以作为标识符的开头, 包括下划线和各种语言的字母
+func (c Char) IsAlpha() bool {
+	return c.id == '_' || unicode.IsLetter(c.id)
 }
 
-func (c *Char) Equal(s interface{}) bool {
+func (c Char) Equal(s interface{}) bool {
 	switch s.(type) {
 	case int:
 		return int(c.id) == s
 	case string:
 		if s != "" {
-			r, _ := utf8.DecodeRune([]byte(s.(string)))
+			r, _ := utf8.DecodeRuneInString(s.(string))
 			return r == c.id
 		}
 		return c.id == 0
@@ -47,14 +49,15 @@ func (c *Char) Equal(s interface{}) bool {
 	return false
 }
 
-func (c *Char) IsAlNum() bool {
-	return c.IsDigital() || c.IsAlpha()
+// IsAlNum 判断是否可以出现在标识符中, 数字同样按 Unicode 分类判断
+func (c Char) IsAlNum() bool {
+	return c.IsAlpha() || unicode.IsDigit(c.id)
 }
 
-func (c *Char) Rune() int32 {
+func (c Char) Rune() int32 {
 	return c.id
 }
 
-func (c *Char) Quote() string {
+func (c Char) Quote() string {
 	return strconv.Quote(string(c.id))
 }
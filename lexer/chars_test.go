@@ -24,6 +24,21 @@ func TestChar_IsAlNum(t *testing.T) {
 			fields: fields{id: 67},
 			want:   true,
 		},
+		{
+			name:   "han",
+			fields: fields{id: '变'},
+			want:   true,
+		},
+		{
+			name:   "arabic-indic digit",
+			fields: fields{id: '٣'},
+			want:   true,
+		},
+		{
+			name:   "punct",
+			fields: fields{id: '，'},
+			want:   false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
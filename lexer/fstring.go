@@ -0,0 +1,154 @@
+package lexer
+
+import (
+	"Interpreter/tokens"
+	"strings"
+)
+
+// fstring 读取 f"..." 插值字符串, 把普通文本和 {} 中的表达式拆分到 Parts 中,
+// {{ 和 }} 表示字面的花括号, 表达式后可以用 ":" 加格式说明
+func (l *Lexer) fstring() *tokens.Token {
+	start := *l.Loc
+	l.advance(1) // skip f
+	quote := l.cur.Rune()
+	triple := l.peek().Rune() == quote && l.peekN(2).Rune() == quote
+	if triple {
+		l.advance(3)
+	} else {
+		l.advance(1)
+	}
+	var parts []tokens.FPart
+	var rs []rune
+	flush := func() {
+		if len(rs) > 0 {
+			parts = append(parts, tokens.FPart{Text: string(rs)})
+			rs = nil
+		}
+	}
+	token := func() *tokens.Token {
+		flush()
+		t := tokens.NToken(tokens.FString, fstringLiteral(parts), l.Loc)
+		t.Parts = parts
+		return t
+	}
+	for {
+		switch {
+		case l.cur.IsNull(), l.cur.Equal("\n") && !triple:
+			l.errorAt(start, "unterminated string literal")
+			return token()
+		case l.cur.Rune() == quote:
+			if !triple {
+				l.advance(1)
+				return token()
+			}
+			if l.peek().Rune() == quote && l.peekN(2).Rune() == quote {
+				l.advance(3)
+				return token()
+			}
+			rs = append(rs, quote)
+			l.advance(1)
+		case l.cur.Equal("{") && l.peek().Equal("{"), l.cur.Equal("}") && l.peek().Equal("}"):
+			rs = append(rs, l.cur.Rune())
+			l.advance(2)
+		case l.cur.Equal("}"):
+			brace := *l.Loc
+			l.advance(1)
+			l.errorAt(brace, "single '}' is not allowed in f-string")
+		case l.cur.Equal("{"):
+			flush()
+			// 出错时 replacement 停在引号或换行处, 由循环继续处理字符串的结尾
+			if part, ok := l.replacement(quote, triple); ok {
+				parts = append(parts, part)
+			}
+		case l.cur.Equal("\\"):
+			rs = l.escape(rs)
+		default:
+			rs = append(rs, l.cur.Rune())
+			l.advance(1)
+		}
+	}
+}
+
+// replacement 读取 {} 中的表达式和格式说明, 表达式中可以包含括号和另一种引号的字符串
+func (l *Lexer) replacement(quote rune, triple bool) (tokens.FPart, bool) {
+	open := *l.Loc
+	l.advance(1) // skip {
+	part := tokens.FPart{Expr: true, Loc: *l.Loc}
+	var expr, spec []rune
+	depth := 0
+	inSpec := false
+	for {
+		closing := l.cur.Rune() == quote &&
+			(!triple || l.peek().Rune() == quote && l.peekN(2).Rune() == quote)
+		switch {
+		case l.cur.IsNull(), l.cur.Equal("\n") && !triple, closing:
+			l.errorAt(open, "unterminated expression in f-string")
+			return part, false
+		case inSpec && l.cur.Equal("}"):
+			goto Done
+		case inSpec:
+			spec = append(spec, l.cur.Rune())
+			l.advance(1)
+		case l.cur.Equal(`"`), l.cur.Equal(`'`):
+			// 表达式中的字符串原样保留, 交给语法分析时再处理转义
+			q := l.cur.Rune()
+			expr = append(expr, q)
+			l.advance(1)
+			for l.cur.Rune() != q {
+				if l.cur.IsNull() || l.cur.Equal("\n") {
+					l.errorAt(open, "unterminated string in f-string expression")
+					return part, false
+				}
+				if l.cur.Equal("\\") {
+					expr = append(expr, l.cur.Rune())
+					l.advance(1)
+				}
+				expr = append(expr, l.cur.Rune())
+				l.advance(1)
+			}
+			expr = append(expr, q)
+			l.advance(1)
+		case l.cur.Equal("("), l.cur.Equal("["), l.cur.Equal("{"):
+			depth++
+			expr = append(expr, l.cur.Rune())
+			l.advance(1)
+		case l.cur.Equal("}") && depth == 0:
+			goto Done
+		case l.cur.Equal(")"), l.cur.Equal("]"), l.cur.Equal("}"):
+			depth--
+			expr = append(expr, l.cur.Rune())
+			l.advance(1)
+		case l.cur.Equal(":") && depth == 0:
+			inSpec = true
+			l.advance(1)
+		default:
+			expr = append(expr, l.cur.Rune())
+			l.advance(1)
+		}
+	}
+Done:
+	l.advance(1) // skip }
+	if strings.TrimSpace(string(expr)) == "" {
+		l.errorAt(open, "empty expression not allowed in f-string")
+		return part, false
+	}
+	part.Text, part.Spec = string(expr), string(spec)
+	return part, true
+}
+
+// fstringLiteral 把各段重新拼成源码形式, 用于输出和调试
+func fstringLiteral(parts []tokens.FPart) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		if !p.Expr {
+			sb.WriteString(strings.NewReplacer("{", "{{", "}", "}}").Replace(p.Text))
+			continue
+		}
+		sb.WriteString("{" + p.Text)
+		if p.Spec != "" {
+			sb.WriteString(":" + p.Spec)
+		}
+		sb.WriteString("}")
+	}
+	return sb.String()
+}
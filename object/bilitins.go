@@ -2,6 +2,7 @@ package object
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -37,7 +38,7 @@ var BuiltinFns = []BuiltinFn{
 			}
 			arg := args[0]
 			return builtLen(arg)
-		}},
+		}, Params: []string{"obj"}},
 	},
 	{
 		"type",
@@ -47,7 +48,7 @@ var BuiltinFns = []BuiltinFn{
 			}
 			arg := args[0]
 			return String{Value: []rune(fmt.Sprintf("<class '%s'>", arg.Type()))}
-		}},
+		}, Params: []string{"obj"}},
 	},
 	{
 		"int",
@@ -57,7 +58,7 @@ var BuiltinFns = []BuiltinFn{
 			}
 			arg := args[0]
 			return builtInt(arg)
-		}},
+		}, Params: []string{"x"}},
 	},
 	{
 		"float",
@@ -67,8 +68,59 @@ var BuiltinFns = []BuiltinFn{
 			}
 			arg := args[0]
 			return builtFloat(arg)
+		}, Params: []string{"x"}},
+	},
+	{
+		"args",
+		Builtin{Fn: func(args ...Object) Object {
+			if obj := checkArgs("args", args, 0); obj != nil {
+				return obj
+			}
+			ele := make([]Object, len(scriptArgs))
+			copy(ele, scriptArgs)
+			return Array{Elements: ele}
 		}},
 	},
+	{
+		"range",
+		// 只有一个参数时它是 stop, 参数的含义取决于个数, 所以不接受关键字参数
+		Builtin{Fn: func(args ...Object) Object {
+			return builtRange(args)
+		}},
+	},
+	{
+		"exit",
+		Builtin{Fn: func(args ...Object) Object {
+			if len(args) == 0 {
+				os.Exit(0)
+			}
+			if obj := checkArgs("exit", args, 1); obj != nil {
+				return obj
+			}
+			status, ok := args[0].(Int)
+			if !ok {
+				return Error{ErrorMsg: fmt.Sprintf("exit() don't support type %s.", args[0].Type())}
+			}
+			os.Exit(status.Value)
+			return nil
+		}, Params: []string{"status"}},
+	},
+}
+
+func init() {
+	for i := range BuiltinFns {
+		BuiltinFns[i].Builtin.Name = BuiltinFns[i].Name
+	}
+}
+
+// scriptArgs 是 args() 返回的脚本参数, 第一个元素为脚本路径
+var scriptArgs []Object
+
+func SetArgs(args []string) {
+	scriptArgs = make([]Object, 0, len(args))
+	for _, arg := range args {
+		scriptArgs = append(scriptArgs, String{Value: []rune(arg)})
+	}
 }
 
 func GetBuiltinFn(name string) Builtin {
@@ -82,8 +134,8 @@ func GetBuiltinFn(name string) Builtin {
 
 func checkArgs(funcName string, args []Object, ArgsNum int) Object {
 	if len(args) != ArgsNum {
-		return Error{ErrorMsg: fmt.Sprintf("%s() takes exactly one argument (%d given)",
-			funcName, len(args))}
+		return Error{ErrorMsg: fmt.Sprintf("%s() takes exactly %d argument(s) (%d given)",
+			funcName, ArgsNum, len(args))}
 	}
 	return nil
 }
@@ -97,12 +149,42 @@ func builtLen(arg Object) Object {
 		length = len(arg.Elements)
 	case Map:
 		length = arg.Size
+	case Range:
+		length = arg.Len()
 	default:
 		return Error{ErrorMsg: fmt.Sprintf("len don't support type %s.", arg.Type())}
 	}
 	return Int{Value: length}
 }
 
+// builtRange 支持 range(stop), range(start, stop) 和 range(start, stop, step)
+func builtRange(args []Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return Error{ErrorMsg: fmt.Sprintf("range() takes 1 to 3 argument(s) (%d given)", len(args))}
+	}
+	nums := make([]int, len(args))
+	for i, arg := range args {
+		n, ok := arg.(Int)
+		if !ok {
+			return Error{ErrorMsg: fmt.Sprintf("range() don't support type %s.", arg.Type())}
+		}
+		nums[i] = n.Value
+	}
+	r := Range{Step: 1}
+	switch len(nums) {
+	case 1:
+		r.Stop = nums[0]
+	case 2:
+		r.Start, r.Stop = nums[0], nums[1]
+	case 3:
+		r.Start, r.Stop, r.Step = nums[0], nums[1], nums[2]
+	}
+	if r.Step == 0 {
+		return Error{ErrorMsg: "range() step must not be zero."}
+	}
+	return r
+}
+
 func builtInt(arg Object) Object {
 	var res int
 	switch arg := arg.(type) {
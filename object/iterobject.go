@@ -0,0 +1,67 @@
+package object
+
+// Iterator 依次产生容器中的元素, 每一步得到下标或键 key 以及对应的值 value
+type Iterator struct {
+	next func() (key, value Object, ok bool)
+	// ByKey 为 true 时单变量循环取 key, 例如遍历 Map 得到的是键
+	ByKey bool
+}
+
+func (it Iterator) Type() ObjType {
+	return IteratorObj
+}
+
+func (it Iterator) Inspect() string {
+	return "<iterator>"
+}
+
+// Next 返回下一组 key 和 value, 迭代结束时 ok 为 false
+func (it Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// NewIterator 为 Array, String, Map 和 Range 创建迭代器, 其他类型返回 false
+func NewIterator(obj Object) (Iterator, bool) {
+	i := 0
+	switch obj := obj.(type) {
+	case Array:
+		return Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return Int{Value: i - 1}, obj.Elements[i-1], true
+		}}, true
+	case String:
+		return Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Value) {
+				return nil, nil, false
+			}
+			i++
+			return Int{Value: i - 1}, String{Value: []rune{obj.Value[i-1]}}, true
+		}}, true
+	case Map:
+		// 按插入顺序遍历, 迭代开始后新增的键不会出现
+		keys := obj.Keys
+		return Iterator{next: func() (Object, Object, bool) {
+			for i < len(keys) {
+				p, ok := obj.Store[keys[i]]
+				i++
+				if ok {
+					return p.Key, p.Item, true
+				}
+			}
+			return nil, nil, false
+		}, ByKey: true}, true
+	case Range:
+		n := obj.Len()
+		return Iterator{next: func() (Object, Object, bool) {
+			if i >= n {
+				return nil, nil, false
+			}
+			i++
+			return Int{Value: i - 1}, Int{Value: obj.Start + (i-1)*obj.Step}, true
+		}}, true
+	}
+	return Iterator{}, false
+}
@@ -25,9 +25,20 @@ func (p *MapPair) Inspect() string {
 	return key + ": " + item
 }
 
-type Map struct {
+// MapData 是字典的内容, 字典的所有副本共享同一份, 通过任何一个副本的修改对其他副本都可见
+type MapData struct {
 	Store map[int]MapPair
 	Size  int
+	// Keys 按插入顺序记录键的哈希值, 输出和遍历都按照这个顺序
+	Keys []int
+}
+
+type Map struct {
+	*MapData
+}
+
+func NewMap() Map {
+	return Map{&MapData{Store: map[int]MapPair{}}}
 }
 
 func (m Map) Type() ObjType {
@@ -37,16 +48,12 @@ func (m Map) Type() ObjType {
 func (m Map) Inspect() string {
 	var sb strings.Builder
 	sb.WriteString("{")
-	if m.Size > 0 {
-		idx := 1
-		for _, p := range m.Store {
-			if idx != m.Size {
-				sb.WriteString(p.Inspect() + ", ")
-			} else {
-				sb.WriteString(p.Inspect())
-			}
-			idx += 1
+	for i, hash := range m.Keys {
+		p := m.Store[hash]
+		if i > 0 {
+			sb.WriteString(", ")
 		}
+		sb.WriteString(p.Inspect())
 	}
 	sb.WriteString("}")
 	return sb.String()
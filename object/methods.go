@@ -6,11 +6,15 @@ import (
 )
 
 func FindMethod(objType ObjType, methodName string) (Object, error) {
+	var methods ObjMethods
 	switch objType {
 	case ArrayObj:
-		return ArrayMethodList[methodName], nil
+		methods = ArrayMethodList
 	case StringObj:
-		return StringMethodList[methodName], nil
+		methods = StringMethodList
+	}
+	if method, ok := methods[methodName]; ok {
+		return method, nil
 	}
 	return nil, fmt.Errorf(format.Alert+"Object %s don't has method \"%s\"", string(objType), methodName)
 }
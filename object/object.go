@@ -34,6 +34,9 @@ type Object interface {
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// Name 和 Params 用于按参数名传参, Params 为空的函数只接受位置参数
+	Name   string
+	Params []string
 }
 
 func (b Builtin) Type() ObjType {
@@ -47,10 +50,16 @@ func (b Builtin) Inspect() string {
 type CompiledFunc struct {
 	FnName        string
 	Instructions  code.Instructions
+	Spans         code.SpanTable
 	LocalsNum     int
 	ParametersNum int
 	Called        bool
 	LineLoc       int
+	ParamNames    []string
+	// Variadic 表示最后一个局部变量 ...rest 收集多余的位置参数
+	Variadic bool
+	// FreeVars 是函数捕获的外层变量, 创建闭包时按顺序取得
+	FreeVars []FreeVar
 }
 
 func (cf CompiledFunc) Type() ObjType {
@@ -61,6 +70,29 @@ func (cf CompiledFunc) Inspect() string {
 	return fmt.Sprintf("CompiledFunc[%p]", &cf)
 }
 
+// FreeVar 描述一个被捕获的变量, Local 为 true 时是外层函数的局部变量,
+// 否则是外层函数自己捕获的变量, Index 为对应的槽位
+type FreeVar struct {
+	Local bool
+	Index int
+}
+
+// Closure 是捕获了外层变量或带有参数默认值的函数, Free 中的变量与外层函数共享,
+// Defaults 对应最后 len(Defaults) 个参数
+type Closure struct {
+	Fn       CompiledFunc
+	Free     []*Object
+	Defaults []Object
+}
+
+func (c Closure) Type() ObjType {
+	return ClosureObj
+}
+
+func (c Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%s]", c.Fn.FnName)
+}
+
 type Slice struct {
 	Start, End, Step Object
 }
@@ -0,0 +1,30 @@
+package object
+
+import "fmt"
+
+// Range 是 range() 返回的整数序列, 元素在迭代时才逐个产生
+type Range struct {
+	Start, Stop, Step int
+}
+
+func (r Range) Type() ObjType {
+	return RangeObj
+}
+
+func (r Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.Stop)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
+// Len 返回序列中元素的个数
+func (r Range) Len() int {
+	var n int
+	if r.Step > 0 && r.Start < r.Stop {
+		n = (r.Stop - r.Start + r.Step - 1) / r.Step
+	} else if r.Step < 0 && r.Start > r.Stop {
+		n = (r.Start - r.Stop - r.Step - 1) / -r.Step
+	}
+	return n
+}
@@ -11,9 +11,13 @@ const (
 
 	BuiltinObj      = "Builtin"
 	CompiledFuncObj = "Compiled"
+	ClosureObj      = "Closure"
 	Method          = "Method"
 
 	ArrayObj = "Array"
 	SliceObj = "Slice"
 	MapObj   = "Map"
+
+	RangeObj    = "Range"
+	IteratorObj = "Iterator"
 )
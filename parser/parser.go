@@ -5,8 +5,9 @@ import (
 	"Interpreter/errors"
 	"Interpreter/lexer"
 	"Interpreter/tokens"
-	"reflect"
+	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
@@ -18,6 +19,9 @@ type Parser struct {
 	prefixFns map[string]prefixParseFn
 	infixFns  map[string]infixParseFn
 	SymTable  *SymTable
+	panicking bool          // 报告错误之后到同步到下一条语句之前为 true
+	badToken  *tokens.Token // 词法分析时出错的 token, 错误已经由词法分析器报告
+	lexErrs   int
 }
 
 func (p *Parser) regPrefixFn(token string, fn prefixParseFn) {
@@ -36,17 +40,16 @@ func NewParser(lex *lexer.Lexer) *Parser {
 		infixFns:  map[string]infixParseFn{},
 		SymTable:  NewSymTable("Base"),
 	}
-	//确保词法分析器位置正确
-	p.lex.Loc = &tokens.Locate{Column: 1, Line: 1}
-
 	p.regPrefixFn(tokens.LParen, p.parseGroupedExpr)
 	p.regPrefixFn(tokens.Plus, p.parsePrefixExpr)
 	p.regPrefixFn(tokens.Minus, p.parsePrefixExpr)
 	p.regPrefixFn(tokens.Not, p.parsePrefixExpr)
+	p.regPrefixFn(tokens.BitNot, p.parsePrefixExpr)
 	p.regPrefixFn(tokens.Int, p.parseInt)
 	p.regPrefixFn(tokens.Float, p.parseFloat)
 	p.regPrefixFn(tokens.Ident, p.parseIdentifier)
 	p.regPrefixFn(tokens.String, p.parseString)
+	p.regPrefixFn(tokens.FString, p.parseFString)
 	p.regPrefixFn(tokens.False, p.parseBoolean)
 	p.regPrefixFn(tokens.True, p.parseBoolean)
 	p.regPrefixFn(tokens.None, p.parseNone)
@@ -55,41 +58,69 @@ func NewParser(lex *lexer.Lexer) *Parser {
 	p.regPrefixFn(tokens.Func, p.parseFuncDef)
 	p.regPrefixFn(tokens.LBRACKET, p.parseArray)
 	p.regPrefixFn(tokens.LBRACE, p.parseMap)
-	p.regPrefixFn(tokens.LF, p.skipLF)
 
 	p.regInfixFn(tokens.Minus, p.parseInfixExpr)
 	p.regInfixFn(tokens.Plus, p.parseInfixExpr)
 	p.regInfixFn(tokens.Mul, p.parseInfixExpr)
 	p.regInfixFn(tokens.Div, p.parseInfixExpr)
+	p.regInfixFn(tokens.FDiv, p.parseInfixExpr)
 	p.regInfixFn(tokens.Mod, p.parseInfixExpr)
 	p.regInfixFn(tokens.Pow, p.parseInfixExpr)
-	p.regInfixFn(tokens.LT, p.parseInfixExpr)
-	p.regInfixFn(tokens.LTEq, p.parseInfixExpr)
-	p.regInfixFn(tokens.GT, p.parseInfixExpr)
-	p.regInfixFn(tokens.GTEq, p.parseInfixExpr)
-	p.regInfixFn(tokens.Equal, p.parseInfixExpr)
-	p.regInfixFn(tokens.NotEq, p.parseInfixExpr)
+	p.regInfixFn(tokens.LT, p.parseComparison)
+	p.regInfixFn(tokens.LTEq, p.parseComparison)
+	p.regInfixFn(tokens.GT, p.parseComparison)
+	p.regInfixFn(tokens.GTEq, p.parseComparison)
+	p.regInfixFn(tokens.Equal, p.parseComparison)
+	p.regInfixFn(tokens.NotEq, p.parseComparison)
 	p.regInfixFn(tokens.And, p.parseInfixExpr)
 	p.regInfixFn(tokens.Or, p.parseInfixExpr)
+	p.regInfixFn(tokens.BitAnd, p.parseInfixExpr)
+	p.regInfixFn(tokens.BitOr, p.parseInfixExpr)
+	p.regInfixFn(tokens.BitXor, p.parseInfixExpr)
+	p.regInfixFn(tokens.Shl, p.parseInfixExpr)
+	p.regInfixFn(tokens.Shr, p.parseInfixExpr)
 
 	p.regInfixFn(tokens.LParen, p.parseCallFunc)
 	p.regInfixFn(tokens.LBRACKET, p.parseIndexInfix)
 	p.regInfixFn(tokens.Dot, p.parseMethodCall)
+	p.regInfixFn(tokens.If, p.parseConditional)
+	p.regInfixFn(tokens.In, p.parseComparison)
+	p.regInfixFn(tokens.Not, p.parseComparison)
 
 	p.init()
 	p.next()
 	return p
 }
 
+// NewParserWithSymTable 使用已有的符号表, 交互模式下多次输入共享同一份符号
+func NewParserWithSymTable(lex *lexer.Lexer, table *SymTable) *Parser {
+	p := NewParser(lex)
+	p.SymTable = table
+	return p
+}
+
 func (p *Parser) init() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lex.NextToken()
+	p.checkBad()
 }
 
 func (p *Parser) next() {
 	p.prevToken = p.curToken
 	p.curToken = p.peekToken
 	p.peekToken = p.lex.NextToken()
+	p.checkBad()
+}
+
+// checkBad 记录刚读到的出错 token, 语句走到它时进入恐慌模式, 不再为它重复报错
+func (p *Parser) checkBad() {
+	if n := len(p.lex.Errs()); n > p.lexErrs {
+		p.lexErrs = n
+		p.badToken = p.peekToken
+	}
+	if p.curToken != nil && p.curToken == p.badToken {
+		p.panicking = true
+	}
 }
 
 func (p *Parser) eat(Type ...string) {
@@ -99,8 +130,56 @@ func (p *Parser) eat(Type ...string) {
 			return
 		}
 	}
-	p.NewErrorF("Want %s but get %s.(col%d,line%d)", Type, p.curToken.Type,
-		p.curToken.Loc.Column, p.curToken.Loc.Line)
+	p.expected(p.curToken, Type...)
+}
+
+// expected 报告 found 处缺少 Type 中的某一种 token
+func (p *Parser) expected(found *tokens.Token, Type ...string) {
+	if found == p.badToken {
+		p.panicking = true
+		return
+	}
+	names := make([]string, len(Type))
+	for i, t := range Type {
+		names[i] = tokens.Name(t)
+	}
+	p.errorAt(found.Span(), "expected %s but found %s", strings.Join(names, " or "), found.Describe())
+}
+
+// errorAt 在 span 处报告语法错误并进入恐慌模式, 同步到下一条语句之前的错误都会被丢弃,
+// 避免一个错误引起一连串的误报
+func (p *Parser) errorAt(span tokens.Span, format string, args ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.Push(errors.Diagnostic{Msg: fmt.Sprintf(format, args...), Span: span})
+}
+
+// synchronize 跳过出错语句剩下的 token, 停在语句结尾的换行或者所在代码块的 "}" 上
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.curToken.IsEOF() {
+		switch p.curToken.Type {
+		case tokens.LParen, tokens.LBRACKET, tokens.LBRACE:
+			depth++
+		case tokens.RParen, tokens.RBRACKET:
+			depth--
+		case tokens.RBRACE:
+			if depth <= 0 {
+				p.panicking = false
+				return
+			}
+			depth--
+		case tokens.LF:
+			if depth <= 0 {
+				p.panicking = false
+				return
+			}
+		}
+		p.next()
+	}
+	p.panicking = false
 }
 
 func (p *Parser) find(Type string) bool {
@@ -110,11 +189,10 @@ func (p *Parser) find(Type string) bool {
 	return p.curToken.Type == Type
 }
 
-func (p *Parser) skipLF() ast.Expression {
+func (p *Parser) skipLF() {
 	for p.curToken.IsLF() {
 		p.next()
 	}
-	return nil
 }
 
 func (p *Parser) eatPeek(Type string) bool {
@@ -122,8 +200,7 @@ func (p *Parser) eatPeek(Type string) bool {
 		p.next()
 		return true
 	}
-	p.NewErrorF("Want %s but get %s.(col%d,line%d)", Type, p.curToken.Type,
-		p.curToken.Loc.Column, p.curToken.Loc.Line)
+	p.expected(p.peekToken, Type)
 	return false
 }
 
@@ -134,6 +211,9 @@ func (p *Parser) parseProgram() ast.Program {
 		if stmt != nil {
 			statements = append(statements, stmt)
 		}
+		if p.panicking {
+			p.synchronize()
+		}
 		if p.curToken.Type == tokens.LF {
 			p.skipLF()
 		} else {
@@ -151,14 +231,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		switch p.peekToken.Type {
 		case tokens.Assign:
 			return p.parseAssignStatement()
-		case tokens.LParen:
-			return p.parseCallStatement()
-		case tokens.LBRACKET:
-			return p.parseExprAssign()
-		case tokens.Dot:
-			return p.parseMethodCallStmt()
-		case tokens.IPlus, tokens.IMinus, tokens.IMul,
-			tokens.IDiv, tokens.IPow, tokens.IMod:
+		case tokens.Colon:
+			return p.parseLabeledLoop()
+		case tokens.Comma:
+			return p.parseUnpackAssign(*p.curToken, false)
+		}
+		if _, ok := tokens.Compound[p.peekToken.Type]; ok {
 			return p.parseReplaceAssign()
 		}
 		return p.parseExprStatement()
@@ -166,11 +244,13 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseReturnStatement()
 	case tokens.Func:
 		return p.parseFuncStatement()
-	case tokens.Break:
+	case tokens.Break, tokens.Continue:
 		return p.parseBreakStmt()
 	case tokens.LF:
 		p.next()
 		return p.parseStatement()
+	case tokens.EOF:
+		return nil
 	default:
 		res := p.parseExprStatement()
 		if p.peekToken.IsLF() {
@@ -179,18 +259,43 @@ func (p *Parser) parseStatement() ast.Statement {
 		return res
 	}
 }
+
+// parseBreakStmt 解析 break 和 continue, 后面可以跟一个循环标签
 func (p *Parser) parseBreakStmt() ast.Statement {
-	token := p.curToken
-	return ast.ExprStatement{Expression: ast.BreakExpr{Token: *token}}
+	token := *p.curToken
+	var label *ast.IdentNode
+	if p.peekToken.Type == tokens.Ident {
+		p.next()
+		label = &ast.IdentNode{
+			Token: *p.curToken,
+			Value: p.curToken.Literal,
+		}
+	}
+	if token.Type == tokens.Continue {
+		return ast.ExprStatement{Expression: ast.ContinueExpr{Token: token, Label: label}}
+	}
+	return ast.ExprStatement{Expression: ast.BreakExpr{Token: token, Label: label}}
 }
 
-func (p *Parser) parseMethodCallStmt() ast.Statement {
-	token := p.curToken
-	expr := p.parseExpr(LOWEST)
-	return ast.MethodCallStmt{
-		Token: *token,
-		Call:  expr,
+// parseLabeledLoop 解析 label: for (...) {...}
+func (p *Parser) parseLabeledLoop() ast.Statement {
+	label := *p.curToken
+	p.eat(tokens.Ident)
+	p.eat(tokens.Colon)
+	if p.curToken.Type != tokens.For {
+		p.errorAt(label.Span(), "label %s must be followed by a for loop", label.Literal)
+		return nil
 	}
+	stmt := p.parseStatement().(ast.ExprStatement)
+	switch loop := stmt.Expression.(type) {
+	case ast.ForExpression:
+		loop.Label = label.Literal
+		stmt.Expression = loop
+	case ast.ForInExpression:
+		loop.Label = label.Literal
+		stmt.Expression = loop
+	}
+	return stmt
 }
 
 func (p *Parser) parseReplaceAssign() ast.Statement {
@@ -208,7 +313,14 @@ func (p *Parser) parseReplaceAssign() ast.Statement {
 
 func (p *Parser) parseVarStatement() ast.Statement {
 	token := *p.curToken // Var tokens
+	if p.peekToken.Type == tokens.LBRACKET {
+		p.next()
+		return p.parseUnpackAssign(token, true)
+	}
 	p.eatPeek(tokens.Ident)
+	if p.peekToken.Type == tokens.Comma {
+		return p.parseUnpackAssign(token, true)
+	}
 	ident := ast.IdentNode{
 		Token: *p.curToken,
 		Value: p.curToken.Literal,
@@ -220,13 +332,6 @@ func (p *Parser) parseVarStatement() ast.Statement {
 	if p.peekToken.IsLF() {
 		p.next()
 	}
-	if reflect.TypeOf(value).Name() == "MethodCall" {
-		return ast.VarMethodCall{
-			Token:  token,
-			Indent: ident,
-			Value:  value,
-		}
-	}
 	return ast.VarStatement{
 		Token:  token,
 		Indent: ident,
@@ -244,6 +349,17 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 		}
 	}
 	returnVal := p.parseExpr(LOWEST)
+	// return a, b 返回由各个值组成的数组
+	if p.peekToken.Type == tokens.Comma {
+		values := ast.Array{Token: token, Elements: []ast.Expression{returnVal}}
+		for p.peekToken.Type == tokens.Comma {
+			p.next()
+			p.next()
+			values.Elements = append(values.Elements, p.parseExpr(LOWEST))
+		}
+		values.End = p.curToken.End
+		returnVal = values
+	}
 	if p.peekToken.IsLF() {
 		p.next()
 	}
@@ -253,6 +369,62 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	}
 }
 
+// parseUnpackAssign 解析 a, b = x, y 和 var a, [b, c] = x 等多目标赋值, 当前 token 为第一个目标
+func (p *Parser) parseUnpackAssign(token tokens.Token, declare bool) ast.Statement {
+	stmt := ast.UnpackAssign{Token: token}
+	stmt.Targets = []ast.Expression{p.parseTarget(declare)}
+	for p.peekToken.Type == tokens.Comma {
+		p.next()
+		p.next()
+		stmt.Targets = append(stmt.Targets, p.parseTarget(declare))
+	}
+	p.eatPeek(tokens.Assign)
+	p.next()
+	stmt.Values = []ast.Expression{p.parseExpr(LOWEST)}
+	for p.peekToken.Type == tokens.Comma {
+		p.next()
+		p.next()
+		stmt.Values = append(stmt.Values, p.parseExpr(LOWEST))
+	}
+	if p.peekToken.IsLF() {
+		p.next()
+	}
+	return stmt
+}
+
+// parseTarget 解析一个赋值目标, declare 为 true 时定义新变量, 结束时停在目标的最后一个 token
+func (p *Parser) parseTarget(declare bool) ast.Expression {
+	token := *p.curToken
+	switch token.Type {
+	case tokens.Ident:
+		if declare {
+			p.SymTable.Define(token.Literal, I)
+		}
+		return ast.IdentNode{
+			Token: token,
+			Value: token.Literal,
+		}
+	case tokens.LBRACKET:
+		targets := ast.Array{Token: token}
+		p.next()
+		for p.curToken.Type != tokens.RBRACKET && !p.curToken.IsEOF() {
+			targets.Elements = append(targets.Elements, p.parseTarget(declare))
+			p.next()
+			if p.curToken.Type != tokens.Comma {
+				break
+			}
+			p.next()
+		}
+		if p.curToken.Type != tokens.RBRACKET {
+			p.expected(p.curToken, tokens.RBRACKET)
+		}
+		targets.End = p.curToken.End
+		return targets
+	}
+	p.errorAt(token.Span(), "cannot assign to %s", token.Describe())
+	return ast.IdentNode{Token: token, Value: token.Literal}
+}
+
 func (p *Parser) parseAssignStatement() ast.Statement {
 	Ident := *p.curToken // Ident token
 	identifier := p.parseIdentifier()
@@ -269,40 +441,37 @@ func (p *Parser) parseAssignStatement() ast.Statement {
 	}
 }
 
-func (p *Parser) parseCallStatement() ast.Statement {
-	fn := p.parseIdentifier()
-	p.next()
-	token := p.curToken
-	args := p.parseExpressionList(tokens.LParen, tokens.RParen)
-	exp := ast.FuncCallExpr{Token: *token, Function: fn, Arguments: args}
-	p.eat(tokens.RParen)
-	return ast.ExprStatement{Expression: exp}
-}
-
-func (p *Parser) parseExprAssign() ast.Statement {
+// parseExprStatement 解析表达式语句, 表达式后面跟着 = 或复合赋值运算符时是索引赋值,
+// 目标可以是任意的后缀表达式, 例如 grid[i][j] 或 f()[0]
+func (p *Parser) parseExprStatement() ast.Statement {
 	token := p.curToken
-	exp := p.parseIdentifier()
+	target := p.parseExpr(LOWEST)
+	_, compound := tokens.Compound[p.peekToken.Type]
+	if p.peekToken.Type != tokens.Assign && !compound {
+		if p.peekToken.IsLF() {
+			p.next()
+		}
+		return ast.ExprStatement{Expression: target}
+	}
+	indexExpr, ok := target.(ast.IndexExpression)
+	if !ok {
+		p.errorAt(target.Span(), "cannot assign to %s", target.Str())
+		return ast.ExprStatement{Expression: target}
+	}
 	p.next()
-	indexExpr := p.parseIndex(exp)
-	p.eat(tokens.RBRACKET) // skip ]
-	p.eat(tokens.Assign)
-	newExp := p.parseExpr(LOWEST)
+	op := *p.curToken
 	p.next()
-	return ast.ExpressionAssign{
+	newExp := p.parseExpr(LOWEST)
+	stmt := ast.ExpressionAssign{
 		Token: *token,
 		Old:   indexExpr.Left,
 		Key:   indexExpr.Index,
 		New:   newExp,
 	}
-}
-
-func (p *Parser) parseExprStatement() ast.Statement {
-	expr := p.parseExpr(LOWEST)
-	if p.peekToken.IsLF() {
-		p.next()
-		p.skipLF()
+	if compound {
+		stmt.Op = &op
 	}
-	return ast.ExprStatement{Expression: expr}
+	return stmt
 }
 
 func (p *Parser) parseFuncStatement() ast.FuncStatement {
@@ -313,14 +482,16 @@ func (p *Parser) parseFuncStatement() ast.FuncStatement {
 func (p *Parser) parseExpr(precedence int) ast.Expression {
 	prefix := p.prefixFns[p.curToken.Type]
 	if prefix == nil {
-		if !p.curToken.IsEOF() {
-			p.NewErrorF("no prefix parse function for %s",
-				p.curToken.Str())
+		if p.curToken.IsLF() || p.curToken.IsEOF() {
+			p.errorAt(p.curToken.Span(), "expected expression, found %s", p.curToken.Describe())
+		} else {
+			p.errorAt(p.curToken.Span(), "unexpected %s", p.curToken.Describe())
 		}
 		return nil
 	}
 	left := prefix()
-	for precedence < p.peekPrecedence() {
+	// 以代码块结尾的表达式停在 "}" 之后的换行上, 下一行不再作为它的后缀
+	for !p.curToken.IsLF() && precedence < p.peekPrecedence() {
 		infix := p.infixFns[p.peekToken.Type]
 		if infix == nil {
 			return left
@@ -359,6 +530,72 @@ func (p *Parser) parsePrefixExpr() ast.Expression {
 	}
 }
 
+// parseConditional 解析 a if cond else b, else 之后的部分可以继续是条件表达式
+func (p *Parser) parseConditional(consequence ast.Expression) ast.Expression {
+	expr := ast.ConditionalExpr{
+		Token:       *p.curToken,
+		Consequence: consequence,
+	}
+	p.next()
+	expr.Condition = p.parseExpr(Ternary)
+	if !p.eatPeek(tokens.Else) {
+		return expr
+	}
+	p.next()
+	expr.Alternative = p.parseExpr(LOWEST)
+	return expr
+}
+
+// parseComparison 解析比较运算, 同一优先级的比较连续出现时生成 CompareChain
+func (p *Parser) parseComparison(left ast.Expression) ast.Expression {
+	precedence := p.curPrecedence()
+	op, ok := p.compareOp()
+	if !ok {
+		return left
+	}
+	p.next()
+	right := p.parseExpr(precedence)
+	if !p.peekComparison(precedence) {
+		return ast.InfixExpr{
+			Left:  left,
+			Right: right,
+			Op:    op,
+		}
+	}
+	chain := ast.CompareChain{
+		Operands: []ast.Expression{left, right},
+		Ops:      []tokens.Token{op},
+	}
+	for p.peekComparison(precedence) {
+		p.next()
+		op, ok := p.compareOp()
+		if !ok {
+			break
+		}
+		p.next()
+		chain.Ops = append(chain.Ops, op)
+		chain.Operands = append(chain.Operands, p.parseExpr(precedence))
+	}
+	return chain
+}
+
+// compareOp 返回当前的比较运算符, not in 合成为一个 NotIn token
+func (p *Parser) compareOp() (tokens.Token, bool) {
+	op := *p.curToken
+	if op.Type != tokens.Not {
+		return op, true
+	}
+	if !p.eatPeek(tokens.In) {
+		return op, false
+	}
+	op.Type, op.Literal, op.End = tokens.NotIn, "not in", p.curToken.End
+	return op, true
+}
+
+func (p *Parser) peekComparison(precedence int) bool {
+	return comparisons[p.peekToken.Type] && p.peekPrecedence() == precedence
+}
+
 func (p *Parser) parseInfixExpr(left ast.Expression) ast.Expression {
 	op := *p.curToken
 	precedence := p.curPrecedence()
@@ -373,9 +610,10 @@ func (p *Parser) parseInfixExpr(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseInt() ast.Expression {
 	var token = *p.curToken
-	IntVal, e := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	// 词法分析已检查过下划线和前导零, 这里按 Go 的字面量语法解析
+	IntVal, e := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if e != nil {
-		p.Push(e)
+		p.errorAt(token.Span(), "integer literal %s is out of range", token.Literal)
 		return nil
 	}
 	return ast.IntNode{
@@ -386,9 +624,9 @@ func (p *Parser) parseInt() ast.Expression {
 
 func (p *Parser) parseFloat() ast.Expression {
 	var token = *p.curToken
-	floatVal, e := strconv.ParseFloat(p.curToken.Literal, 64)
+	floatVal, e := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
 	if e != nil {
-		p.Push(e)
+		p.errorAt(token.Span(), "float literal %s is out of range", token.Literal)
 		return nil
 	}
 	return ast.FloatNode{
@@ -405,7 +643,7 @@ func (p *Parser) parseNone() ast.Expression {
 func (p *Parser) parseIdentifier() ast.Expression {
 	var node ast.Expression
 	token := p.curToken
-	if p.prevToken.Type == tokens.Dot {
+	if p.prevToken != nil && p.prevToken.Type == tokens.Dot {
 		node = ast.MethodNode{
 			Token: *token,
 			Value: token.Literal,
@@ -420,44 +658,19 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return node
 }
 
-func (p *Parser) parseOneMethodCall() (
-	Methods ast.Expression, Args []ast.Expression) {
-	if p.curToken.Type == tokens.LParen {
-		p.next()
-	}
-	p.next() //skip .
-	Methods = p.parseIdentifier()
-	p.next()
-	if p.curToken.Type == tokens.LParen {
-		Args = p.parseExpressionList(tokens.LParen, tokens.RParen)
-	}
-	if p.curToken.Type != tokens.RParen {
-		p.NewErrorF("syntax error: Invalid parentheses")
-	}
-	if p.peekToken.Type == tokens.Dot {
-		p.eat(tokens.RParen)
-	}
-	return
-}
-
+// parseMethodCall 解析 .name(args), 与索引和调用一样是左结合的后缀
 func (p *Parser) parseMethodCall(left ast.Expression) ast.Expression {
 	token := p.curToken //.
+	p.eatPeek(tokens.Ident)
 	call := ast.MethodCall{
-		Token: *token,
-		Left:  left,
+		Token:  *token,
+		Left:   left,
+		Method: p.parseIdentifier(),
 	}
-	var ms []ast.Expression
-	var args [][]ast.Expression
-	for p.curToken.Type == tokens.Dot {
-		msTmp, argsTmp := p.parseOneMethodCall()
-		ms = append(ms, msTmp)
-		args = append(args, argsTmp)
-	}
-	call.Methods = ms
-	call.Arguments = args
-	if p.peekToken.Type == tokens.LF {
-		p.next()
+	if p.eatPeek(tokens.LParen) {
+		call.Arguments = p.parseExpressionList(tokens.LParen, tokens.RParen)
 	}
+	call.End = p.curToken.End
 	return call
 }
 
@@ -468,6 +681,35 @@ func (p *Parser) parseString() ast.Expression {
 	}
 }
 
+// parseFString 解析插值字符串, {} 中的表达式由共享符号表的子解析器解析
+func (p *Parser) parseFString() ast.Expression {
+	token := *p.curToken
+	node := ast.FString{Token: token}
+	for _, part := range token.Parts {
+		if !part.Expr {
+			node.Parts = append(node.Parts, ast.StringNode{Token: token, Value: part.Text})
+			node.Specs = append(node.Specs, "")
+			continue
+		}
+		lex := lexer.NewLexer(part.Text)
+		*lex.Loc = part.Loc
+		sub := NewParserWithSymTable(lex, p.SymTable)
+		sub.skipLF()
+		expr := sub.parseExpr(LOWEST)
+		sub.next()
+		sub.skipLF()
+		if !sub.curToken.IsEOF() && !sub.HasError() {
+			sub.errorAt(tokens.Span{Start: part.Loc}, "invalid expression %q in f-string", part.Text)
+		}
+		for _, err := range append(lex.Errs(), sub.Errs()...) {
+			p.Push(err)
+		}
+		node.Parts = append(node.Parts, expr)
+		node.Specs = append(node.Specs, part.Spec)
+	}
+	return node
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	boolVal, err := strconv.ParseBool(p.curToken.Literal)
 	if err != nil {
@@ -480,8 +722,19 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseBlockStatement() ast.BlockStatement {
+	block := p.parseBlock()
+	p.eat(tokens.RBRACE)
+	return block
+}
+
+// parseBlock 解析 {...}, 结束时停在 "}" 上
+func (p *Parser) parseBlock() ast.BlockStatement {
 	token := *p.curToken
-	p.eat(tokens.LBRACE)
+	if token.Type != tokens.LBRACE {
+		p.expected(p.curToken, tokens.LBRACE)
+		return ast.BlockStatement{Token: token, End: token.End}
+	}
+	p.next()
 	p.skipLF()
 	var s []ast.Statement
 	for p.curToken.Type != tokens.RBRACE && !p.curToken.IsEOF() {
@@ -489,13 +742,19 @@ func (p *Parser) parseBlockStatement() ast.BlockStatement {
 		if stmt != nil {
 			s = append(s, stmt)
 		}
+		if p.panicking {
+			p.synchronize()
+			if p.curToken.Type == tokens.RBRACE {
+				break
+			}
+		}
 		p.next() //skip }
 		p.skipLF()
 	}
-	p.eat(tokens.RBRACE)
 	return ast.BlockStatement{
 		Token:      token,
 		Statements: s,
+		End:        p.curToken.End,
 	}
 }
 
@@ -507,57 +766,68 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	p.next()
 	p.eat(tokens.RParen)
 	if !p.find(tokens.LBRACE) {
-		p.NewError(`condition need warped by "{}".`)
+		p.errorAt(p.curToken.Span(), `condition need warped by "{}"`)
 	}
 	conSeq := p.parseBlockStatement()
-	if p.curToken.Type == tokens.Else {
-		p.eat(tokens.Else)
-		alter := p.parseBlockStatement()
-		return ast.IfExpression{
-			Token:       token,
-			Condition:   cond,
-			Consequence: &conSeq,
-			Alternative: &alter,
-		}
-	} else {
-		return ast.IfExpression{
-			Token:       token,
-			Condition:   cond,
-			Consequence: &conSeq,
-		}
+	expr := ast.IfExpression{
+		Token:       token,
+		Condition:   cond,
+		Consequence: &conSeq,
+	}
+	// else 可以另起一行
+	if p.curToken.IsLF() && p.peekToken.Type == tokens.Else {
+		p.next()
+	}
+	if p.curToken.Type != tokens.Else {
+		return expr
 	}
+	p.eat(tokens.Else)
+	if p.curToken.Type == tokens.If {
+		elseIf := p.parseIfExpression().(ast.IfExpression)
+		expr.ElseIf = &elseIf
+		return expr
+	}
+	alter := p.parseBlockStatement()
+	expr.Alternative = &alter
+	return expr
 }
 
 func (p *Parser) parseForExpr() ast.Expression {
 	token := *p.curToken //token 'for'
 	p.eat(tokens.For)
 	p.eat(tokens.LParen)
+	if p.curToken.Type == tokens.Ident &&
+		(p.peekToken.Type == tokens.In || p.peekToken.Type == tokens.Comma) {
+		return p.parseForIn(token)
+	}
 	var init, eachOpt ast.Statement
 	var cond ast.Expression
-	if p.curToken.Type == tokens.RParen {
-		goto Res
-	}
-	if p.curToken.Type != tokens.Semi {
+	if p.curToken.Type != tokens.Semi && p.curToken.Type != tokens.RParen {
 		init = p.parseStatement()
 		p.next()
+		if stmt, ok := init.(ast.ExprStatement); ok && p.curToken.Type == tokens.RParen {
+			// for(cond){...}
+			init, cond = nil, stmt.Expression
+		}
 	}
 	if p.curToken.Type == tokens.Semi {
 		p.eat(tokens.Semi)
-		cond = p.parseExpr(LOWEST)
-		p.next()
+		if p.curToken.Type != tokens.Semi {
+			cond = p.parseExpr(LOWEST)
+			p.next()
+		}
 	}
 	if p.curToken.Type == tokens.Semi && p.peekToken.Type != tokens.RParen {
 		p.eat(tokens.Semi)
 		eachOpt = p.parseStatement()
 		p.next()
-	} else {
+	} else if p.curToken.Type == tokens.Semi {
 		p.eat(tokens.Semi)
 	}
 	p.eat(tokens.RParen)
 	if !p.find(tokens.LBRACE) {
-		p.NewError(`loop body need warped by "{}".`)
+		p.errorAt(p.curToken.Span(), `loop body need warped by "{}"`)
 	}
-Res:
 	loop := p.parseBlockStatement()
 	return ast.ForExpression{
 		Token:       token,
@@ -568,43 +838,99 @@ Res:
 	}
 }
 
-func (p *Parser) parseFuncParams() []ast.IdentNode {
-	var params []ast.IdentNode
-	p.eat(tokens.LParen)
-	if p.curToken.Type == tokens.RParen {
-		p.next()
-		return params
+// parseForIn 解析 for (v in iterable) 和 for (k, v in iterable), token 为 for
+func (p *Parser) parseForIn(token tokens.Token) ast.Expression {
+	expr := ast.ForInExpression{Token: token}
+	expr.Value = p.parseLoopVar()
+	if p.curToken.Type == tokens.Comma {
+		p.eat(tokens.Comma)
+		key := expr.Value
+		expr.Key = &key
+		expr.Value = p.parseLoopVar()
+	}
+	p.eat(tokens.In)
+	expr.Iterable = p.parseExpr(LOWEST)
+	p.next()
+	p.eat(tokens.RParen)
+	if !p.find(tokens.LBRACE) {
+		p.errorAt(p.curToken.Span(), `loop body need warped by "{}"`)
 	}
-	param := ast.IdentNode{
+	loop := p.parseBlockStatement()
+	expr.Loop = &loop
+	return expr
+}
+
+// parseLoopVar 读取循环变量, 当前作用域中还没有这个名称时定义它
+func (p *Parser) parseLoopVar() ast.IdentNode {
+	ident := ast.IdentNode{
 		Token: *p.curToken,
 		Value: p.curToken.Literal,
 	}
-	p.next()
-	params = append(params, param)
-	for p.curToken.Type == tokens.Comma {
-		p.next() //skip comma
+	p.eat(tokens.Ident)
+	if _, ok := p.SymTable.store[ident.Value]; !ok {
+		p.SymTable.Define(ident.Value, I)
+	}
+	return ident
+}
+
+// parseFuncParams 解析参数列表, 带默认值的参数必须位于末尾, 默认值在外层作用域中解析,
+// ...rest 只能是最后一个参数
+func (p *Parser) parseFuncParams() ([]ast.IdentNode, []ast.Expression, *ast.IdentNode) {
+	var params []ast.IdentNode
+	var defaults []ast.Expression
+	var rest *ast.IdentNode
+	p.eat(tokens.LParen)
+	for p.curToken.Type != tokens.RParen && !p.curToken.IsEOF() {
+		if p.curToken.Type == tokens.Ellipsis {
+			p.next()
+			rest = &ast.IdentNode{
+				Token: *p.curToken,
+				Value: p.curToken.Literal,
+			}
+			p.eat(tokens.Ident)
+			if p.curToken.Type != tokens.RParen {
+				p.errorAt(rest.Token.Span(), "variadic parameter %s must be the last parameter", rest.Value)
+			}
+			break
+		}
 		param := ast.IdentNode{
 			Token: *p.curToken,
 			Value: p.curToken.Literal,
 		}
 		params = append(params, param)
 		p.next()
+		if p.curToken.Type == tokens.Assign {
+			p.next()
+			defaults = append(defaults, p.parseExpr(LOWEST))
+			p.next()
+		} else if len(defaults) > 0 {
+			p.errorAt(param.Token.Span(), "non-default parameter %s follows default parameter", param.Value)
+		}
+		if p.curToken.Type != tokens.Comma {
+			break
+		}
+		p.next() //skip comma
 	}
 	p.eat(tokens.RParen)
-	return params
+	return params, defaults, rest
 }
-
 func (p *Parser) parseFuncDef() ast.Expression {
 	token := p.curToken
 	p.eat(tokens.Func)
+	if p.curToken.Type == tokens.LParen {
+		return p.parseLambda(*token)
+	}
 	name := p.curToken.Literal
 	p.SymTable.Define(name, F)
-	p.SymTable = NewInnerSymTable(name, p.SymTable)
 	p.next()
-	params := p.parseFuncParams()
+	params, defaults, rest := p.parseFuncParams()
+	p.SymTable = NewInnerSymTable(name, p.SymTable)
 	for _, param := range params {
 		p.SymTable.Define(param.Value, I)
 	}
+	if rest != nil {
+		p.SymTable.Define(rest.Value, I)
+	}
 	body := p.parseBlockStatement()
 	p.SymTable = p.SymTable.Outer
 	return ast.FuncDef{
@@ -612,6 +938,71 @@ func (p *Parser) parseFuncDef() ast.Expression {
 		Parameters: params,
 		FuncBody:   &body,
 		Name:       name,
+		Defaults:   defaults,
+		Rest:       rest,
+	}
+}
+
+// parseLambda 解析匿名函数 def (a, b) {...}, 结束时停在 "}" 上
+func (p *Parser) parseLambda(token tokens.Token) ast.Expression {
+	name := p.SymTable.LambdaName()
+	params, defaults, rest := p.parseFuncParams()
+	p.SymTable = NewInnerSymTable(name, p.SymTable)
+	for _, param := range params {
+		p.SymTable.Define(param.Value, I)
+	}
+	if rest != nil {
+		p.SymTable.Define(rest.Value, I)
+	}
+	body := p.parseBlock()
+	if p.curToken.Type != tokens.RBRACE {
+		p.eat(tokens.RBRACE)
+	}
+	p.SymTable = p.SymTable.Outer
+	return ast.FuncDef{
+		Token:      token,
+		Parameters: params,
+		FuncBody:   &body,
+		Name:       name,
+		Defaults:   defaults,
+		Rest:       rest,
+		Anonymous:  true,
+	}
+}
+
+// parseArrow 解析 (a, b) => expr 中 "=>" 及之后的部分, 进入时停在 ")" 上
+func (p *Parser) parseArrow(token tokens.Token, exps []ast.Expression) ast.Expression {
+	var params []ast.IdentNode
+	for _, exp := range exps {
+		ident, ok := exp.(ast.IdentNode)
+		if !ok && exp != nil {
+			p.errorAt(exp.Span(), "lambda parameter must be an identifier")
+		}
+		if ok {
+			params = append(params, ident)
+		}
+	}
+	p.next()
+	arrow := *p.curToken
+	p.next()
+	name := p.SymTable.LambdaName()
+	p.SymTable = NewInnerSymTable(name, p.SymTable)
+	for _, param := range params {
+		p.SymTable.Define(param.Value, I)
+	}
+	value := p.parseExpr(LOWEST)
+	p.SymTable = p.SymTable.Outer
+	ret := ast.ReturnStatement{Token: arrow, ReturnVal: value}
+	return ast.FuncDef{
+		Token:      token,
+		Parameters: params,
+		FuncBody: &ast.BlockStatement{
+			Token:      arrow,
+			Statements: []ast.Statement{ret},
+			End:        p.curToken.End,
+		},
+		Name:      name,
+		Anonymous: true,
 	}
 }
 
@@ -630,17 +1021,57 @@ func (p *Parser) parseExpressionList(start, end string) []ast.Expression {
 		args = append(args, arg)
 		p.next()
 	}
+	if p.curToken.Type != end {
+		p.expected(p.curToken, tokens.Comma, end)
+	}
 	return args
 }
 
+// parseCallFunc 解析调用参数, name = value 形式的关键字参数必须位于位置参数之后
 func (p *Parser) parseCallFunc(function ast.Expression) ast.Expression {
 	token := p.curToken // (
-	args := p.parseExpressionList(tokens.LParen, tokens.RParen)
 	expr := ast.FuncCallExpr{
-		Token:     *token,
-		Function:  function,
-		Arguments: args,
+		Token:    *token,
+		Function: function,
+	}
+	p.eat(tokens.LParen)
+	for p.curToken.Type != tokens.RParen && !p.curToken.IsEOF() {
+		if p.curToken.Type == tokens.Ident && p.peekToken.Type == tokens.Assign {
+			name := ast.IdentNode{
+				Token: *p.curToken,
+				Value: p.curToken.Literal,
+			}
+			for _, kw := range expr.Keywords {
+				if kw.Name.Value == name.Value {
+					p.errorAt(name.Token.Span(), "keyword argument %s repeated", name.Value)
+				}
+			}
+			p.next()
+			p.next()
+			expr.Keywords = append(expr.Keywords, ast.KeywordArg{Name: name, Value: p.parseExpr(LOWEST)})
+		} else {
+			if len(expr.Keywords) > 0 {
+				p.errorAt(p.curToken.Span(), "positional argument follows keyword argument")
+			}
+			if p.curToken.Type == tokens.Ellipsis {
+				spread := ast.SpreadExpr{Token: *p.curToken}
+				p.next()
+				spread.Value = p.parseExpr(LOWEST)
+				expr.Arguments = append(expr.Arguments, spread)
+			} else {
+				expr.Arguments = append(expr.Arguments, p.parseExpr(LOWEST))
+			}
+		}
+		p.next()
+		if p.curToken.Type != tokens.Comma {
+			break
+		}
+		p.next()
+	}
+	if p.curToken.Type != tokens.RParen {
+		p.expected(p.curToken, tokens.Comma, tokens.RParen)
 	}
+	expr.End = p.curToken.End
 	return expr
 }
 
@@ -650,6 +1081,7 @@ func (p *Parser) parseArray() ast.Expression {
 	return ast.Array{
 		Token:    *token,
 		Elements: args,
+		End:      p.curToken.End,
 	}
 }
 
@@ -663,9 +1095,10 @@ func (p *Parser) parseMap() ast.Expression {
 			Token: *token,
 			Keys:  keys,
 			Items: items,
+			End:   p.curToken.End,
 		}
 	}
-	for p.curToken.Type != tokens.RBRACE {
+	for p.curToken.Type != tokens.RBRACE && !p.curToken.IsEOF() {
 		keys = append(keys, p.parseExpr(LOWEST))
 		p.next()
 		p.eat(tokens.Colon) //:
@@ -673,12 +1106,16 @@ func (p *Parser) parseMap() ast.Expression {
 		p.next()
 		if p.curToken.Type == tokens.Comma {
 			p.eat(tokens.Comma) //skip
+		} else if p.curToken.Type != tokens.RBRACE {
+			p.expected(p.curToken, tokens.Comma, tokens.RBRACE)
+			break
 		}
 	}
 	return ast.Map{
 		Token: *token,
 		Keys:  keys,
 		Items: items,
+		End:   p.curToken.End,
 	}
 }
 
@@ -705,21 +1142,23 @@ func (p *Parser) parseIndex(left ast.Expression) ast.IndexExpression {
 		ie.Index = arg1
 	case tokens.Colon:
 		if p.peekToken.Type == tokens.RBRACKET {
-			slice := ast.IndexSlice{}
+			slice := ast.IndexSlice{Token: *p.curToken, Start: arg1}
 			ie.Index = slice
+			p.next()
 		} else {
 			slice := p.parseSlice()
 			slice.Start = arg1
 			ie.Index = slice
 		}
 	default:
-		p.NewErrorF(`Slice need ":" as break but not %s`, p.curToken.Literal)
+		p.expected(p.curToken, tokens.RBRACKET, tokens.Colon)
 	}
+	ie.End = p.curToken.End
 	return ie
 }
 
 func (p *Parser) parseSlice() ast.IndexSlice {
-	slice := ast.IndexSlice{} //current token :
+	slice := ast.IndexSlice{Token: *p.curToken} //current token :
 	if p.peekToken.Type != tokens.Colon {
 		p.eat(tokens.Colon)
 		slice.End = p.parseExpr(LOWEST)
@@ -745,10 +1184,26 @@ func (p *Parser) parseSlice() ast.IndexSlice {
 }
 
 func (p *Parser) parseGroupedExpr() ast.Expression {
+	token := *p.curToken
 	p.eat(tokens.LParen)
-	exp := p.parseExpr(LOWEST)
+	if p.curToken.Type == tokens.RParen && p.peekToken.Type == tokens.Arrow {
+		return p.parseArrow(token, nil)
+	}
+	exps := []ast.Expression{p.parseExpr(LOWEST)}
+	// 括号中的逗号只能出现在 (a, b) => expr 的参数列表里
+	for p.peekToken.Type == tokens.Comma {
+		p.next()
+		p.next()
+		exps = append(exps, p.parseExpr(LOWEST))
+	}
 	p.eatPeek(tokens.RParen)
-	return exp
+	if p.peekToken.Type == tokens.Arrow {
+		return p.parseArrow(token, exps)
+	}
+	if len(exps) > 1 {
+		p.errorAt(token.Span(), `unexpected "," in parenthesized expression`)
+	}
+	return exps[0]
 }
 
 func (p *Parser) Parse() ast.Statement {
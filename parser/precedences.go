@@ -7,16 +7,21 @@ import (
 
 const (
 	LOWEST    int = iota
-	Method        // .
-	Eq            // == !=
-	GreatLess     // < > <= >=
+	Ternary       // a if cond else b
+	LogicOr       // or
+	LogicAnd      // and
+	GreatLess     // == != < > <= >= in, 所有比较运算符优先级相同, 可以连续书写
+	BitOr         // |
+	BitXor        // ^
+	BitAnd        // &
+	Shift         // << >>
 	SUM           // +,-
-	PRODUCT       // *,/,//
+	PRODUCT       // *,/,//,%
 	POW           //**
 	PREFIX        // -x,!x
-	COMPARE       // and,or,not
+	COMPARE       // not
 	CALL          //()
-	Index         //[]
+	Index         // [] .
 	Highest
 )
 
@@ -30,18 +35,38 @@ var precedences = map[string]int{
 	tokens.Minus:    SUM,
 	tokens.Mul:      PRODUCT,
 	tokens.Div:      PRODUCT,
-	tokens.Mod:      POW,
+	tokens.FDiv:     PRODUCT,
+	tokens.Mod:      PRODUCT,
 	tokens.Pow:      POW,
 	tokens.LParen:   CALL,
-	tokens.Dot:      Method,
-	tokens.Equal:    Eq,
-	tokens.NotEq:    Eq,
+	tokens.Dot:      Index,
+	tokens.Equal:    GreatLess,
+	tokens.NotEq:    GreatLess,
 	tokens.LT:       GreatLess,
 	tokens.GT:       GreatLess,
 	tokens.LTEq:     GreatLess,
 	tokens.GTEq:     GreatLess,
-	tokens.And:      COMPARE,
-	tokens.Or:       COMPARE,
-	tokens.Not:      COMPARE,
+	tokens.And:      LogicAnd,
+	tokens.Or:       LogicOr,
+	tokens.Not:      GreatLess, // a not in b
+	tokens.In:       GreatLess,
 	tokens.LBRACKET: Index,
+	tokens.BitOr:    BitOr,
+	tokens.BitXor:   BitXor,
+	tokens.BitAnd:   BitAnd,
+	tokens.Shl:      Shift,
+	tokens.Shr:      Shift,
+	tokens.If:       Ternary,
+}
+
+// comparisons 记录可以连续书写的比较运算符, 例如 0 <= i < n
+var comparisons = map[string]bool{
+	tokens.Equal: true,
+	tokens.NotEq: true,
+	tokens.LT:    true,
+	tokens.LTEq:  true,
+	tokens.GT:    true,
+	tokens.GTEq:  true,
+	tokens.In:    true,
+	tokens.Not:   true,
 }
@@ -1,5 +1,10 @@
 package parser
 
+import (
+	"sort"
+	"strconv"
+)
+
 type Scope string
 type SymType string
 
@@ -7,6 +12,7 @@ const (
 	Global  Scope   = "Global"
 	Local   Scope   = "Local"
 	BuiltIn Scope   = "BuiltIn"
+	Free    Scope   = "Free"
 	I       SymType = "Indent"
 	F       SymType = "Func"
 )
@@ -56,6 +62,9 @@ type SymTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	Methods        *MethodNames
+	lambdas        int
+	// FreeSymbols 是本函数捕获的外层变量, 记录的是它们在外层函数中的符号
+	FreeSymbols []Symbol
 }
 
 func NewSymTable(name string) *SymTable {
@@ -99,15 +108,44 @@ func (st *SymTable) DefineBuiltin(name string, index int) Symbol {
 	return s
 }
 
+// Resolve 查找名称, 外层函数的局部变量会被登记为本函数的自由变量
 func (st *SymTable) Resolve(name string) (Symbol, bool) {
 	s, ok := st.store[name]
 	if ok {
 		return s, true
 	}
-	if st.Outer != nil && !ok {
-		return st.Outer.Resolve(name)
+	if st.Outer == nil {
+		return Symbol{}, false
+	}
+	s, ok = st.Outer.Resolve(name)
+	if !ok || s.ScopeType == Global || s.ScopeType == BuiltIn {
+		return s, ok
+	}
+	return st.defineFree(s), true
+}
+
+func (st *SymTable) defineFree(original Symbol) Symbol {
+	st.FreeSymbols = append(st.FreeSymbols, original)
+	s := Symbol{
+		Name:      original.Name,
+		Type:      original.Type,
+		ScopeType: Free,
+		Id:        len(st.FreeSymbols) - 1,
+	}
+	st.store[original.Name] = s
+	return s
+}
+
+// Symbols 返回当前作用域内定义的全部符号, 按名称排序
+func (st *SymTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(st.store))
+	for _, s := range st.store {
+		symbols = append(symbols, s)
 	}
-	return Symbol{}, false
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Name < symbols[j].Name
+	})
+	return symbols
 }
 
 func (st *SymTable) FindByIdx(index int) (string, bool) {
@@ -123,6 +161,12 @@ func Search(name string, enter *SymTable) *SymTable {
 	if enter.BlockName == name {
 		return enter
 	}
+	// 先找当前块的直接子块, 不同函数中的同名内部函数互不影响
+	for i := len(enter.Inner) - 1; i >= 0; i-- {
+		if enter.Inner[i].BlockName == name {
+			return enter.Inner[i]
+		}
+	}
 	var cur = enter
 	for cur.Outer != nil {
 		cur = cur.Outer
@@ -132,13 +176,15 @@ func Search(name string, enter *SymTable) *SymTable {
 
 func search(name string, children []*SymTable) *SymTable {
 	var inners []*SymTable
-	for _, c := range children {
-		if c.BlockName == name {
-			return c
-		} else {
-			inners = append(inners, c.Inner...)
+	// 同名的块以最后定义的为准
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i].BlockName == name {
+			return children[i]
 		}
 	}
+	for _, c := range children {
+		inners = append(inners, c.Inner...)
+	}
 	if len(inners) > 0 {
 		return search(name, inners)
 	} else {
@@ -146,6 +192,16 @@ func search(name string, children []*SymTable) *SymTable {
 	}
 }
 
+// LambdaName 为匿名函数生成在整棵符号表中唯一的块名
+func (st *SymTable) LambdaName() string {
+	root := st
+	for root.Outer != nil {
+		root = root.Outer
+	}
+	root.lambdas++
+	return "lambda#" + strconv.Itoa(root.lambdas)
+}
+
 func NewInnerSymTable(name string, enter *SymTable) *SymTable {
 	table := NewSymTable(name)
 	enter.Inner = append(enter.Inner, table)
@@ -153,3 +209,21 @@ func NewInnerSymTable(name string, enter *SymTable) *SymTable {
 	table.Methods = enter.Methods
 	return table
 }
+
+// Snapshot 记录顶层符号表的当前状态, 调用返回的函数会撤销之后新增的定义
+func (st *SymTable) Snapshot() func() {
+	store := make(map[string]Symbol, len(st.store))
+	for name, s := range st.store {
+		store[name] = s
+	}
+	num, inner, lambdas := st.numDefinitions, len(st.Inner), st.lambdas
+	methods, methodIdx := len(st.Methods.methodName), st.Methods.Index
+	return func() {
+		st.store = store
+		st.numDefinitions = num
+		st.Inner = st.Inner[:inner]
+		st.lambdas = lambdas
+		st.Methods.methodName = st.Methods.methodName[:methods]
+		st.Methods.Index = methodIdx
+	}
+}
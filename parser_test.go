@@ -1,13 +1,18 @@
 package main
 
 import (
+	"Interpreter/ast"
+	"Interpreter/bytecode"
+	"Interpreter/code"
 	"Interpreter/compiler"
+	"Interpreter/errors"
 	"Interpreter/lexer"
 	"Interpreter/object"
 	"Interpreter/parser"
 	vm2 "Interpreter/vm"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -373,8 +378,8 @@ print(type(cache["4"]))
 
 func TestParser_Parse(t *testing.T) {
 	st := time.Now()
+	fmt.Println(lexer.NewLexer(s19).Array())
 	lex := lexer.NewLexer(s19)
-	fmt.Println(lex.Array())
 	p := parser.NewParser(lex)
 	ast := p.Parse()
 	if !p.HasError() {
@@ -408,6 +413,7 @@ func BenchmarkExec(b *testing.B) {
 	//	fmt.Println(p.errs, len(p.errs))
 	//}
 	c := compiler.NewCompiler()
+	c.SetSymbol(p.SymTable)
 	c.Compile(ast)
 	//c.ByteCode()
 	vm := vm2.NewVM()
@@ -508,6 +514,7 @@ func TestParseParams(t *testing.T) {
 	ast := p.Parse()
 	fmt.Println(ast.Str())
 	c := compiler.NewCompiler()
+	c.SetSymbol(p.SymTable)
 	c.Compile(ast)
 	c.Debug()
 	vm := vm2.NewVM()
@@ -516,3 +523,406 @@ func TestParseParams(t *testing.T) {
 	}
 	//fmt.Println(vm.LastPop().Inspect())
 }
+
+func TestParser_Span(t *testing.T) {
+	src := "var a = foo(1, 2) + [3][0]\nif (a > 1) {\n\tprint(a)\n}"
+	p := parser.NewParser(lexer.NewLexer(src))
+	program := p.Parse().(ast.Program)
+	if p.HasError() {
+		t.Fatal(p.Errs())
+	}
+	want := []string{"var a = foo(1, 2) + [3][0]", "if (a > 1) {\n\tprint(a)\n}"}
+	for i, stmt := range program.Statements {
+		span := stmt.Span()
+		if got := src[span.Start.Offset:span.End.Offset]; got != want[i] {
+			t.Errorf("statement %d spans %q, want %q", i, got, want[i])
+		}
+	}
+	value := program.Statements[0].(ast.VarStatement).Value.(ast.InfixExpr)
+	span := value.Right.Span()
+	if got := src[span.Start.Offset:span.End.Offset]; got != "[3][0]" {
+		t.Errorf("index spans %q", got)
+	}
+}
+
+func TestParser_Recovery(t *testing.T) {
+	src := "var a = (1 +\nprint(a)\nvar b = [1, 2\nvar c = 3\ndef f(x) {\n  var y = x +* 2\n  return y\n}\nprint(f(1) 2)\n"
+	p := parser.NewParser(lexer.NewLexer(src))
+	p.Parse()
+	want := []string{
+		`expected expression, found newline at col13, line1.`,
+		`expected "," or "]" but found newline at col14, line3.`,
+		`unexpected "*" at col14, line6.`,
+		`expected "," or ")" but found "2" at col12, line9.`,
+	}
+	errs := p.Errs()
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err, want[i])
+		}
+	}
+	runParseCases(t, []evalCase{
+		{src: "var a = 1 +\nprint(a)", err: "expected expression, found newline at col12, line1."},
+		{src: "var a =", err: "expected expression, found end of file at col8, line1."},
+		{src: "[1,\n2]", err: "expected expression, found newline at col4, line1."},
+	})
+	lex := lexer.NewLexer("print(\"abc)\nprint(1 2)\n")
+	p = parser.NewParser(lex)
+	p.Parse()
+	lexErrs := lex.Errs()
+	if len(lexErrs) != 1 || lexErrs[0].Error() != "unterminated string literal at col7, line1." {
+		t.Errorf("lexer errors = %v", lexErrs)
+	}
+	if _, ok := lexErrs[0].(errors.Diagnostic); !ok {
+		t.Errorf("lexer error %T is not a Diagnostic", lexErrs[0])
+	}
+	if errs := p.Errs(); len(errs) != 1 || errs[0].Error() != `expected "," or ")" but found "2" at col9, line2.` {
+		t.Errorf("parser errors after a lexer error = %v", errs)
+	}
+	lex = lexer.NewLexer("var a = 1 $\nprint(1 2)\n")
+	p = parser.NewParser(lex)
+	p.Parse()
+	if lexErrs := lex.Errs(); len(lexErrs) != 1 || lexErrs[0].Error() != "Illegal tokens $ at col11, line1." {
+		t.Errorf("lexer errors = %v", lexErrs)
+	}
+	if errs := p.Errs(); len(errs) != 1 || errs[0].Error() != `expected "," or ")" but found "2" at col9, line2.` {
+		t.Errorf("parser errors after an illegal character = %v", errs)
+	}
+	got := errors.Render(errs[2], src)
+	wantSnippet := "unexpected \"*\" at col14, line6.\n 6 |   var y = x +* 2\n   |              ^"
+	if got != wantSnippet {
+		t.Errorf("Render = %q, want %q", got, wantSnippet)
+	}
+}
+
+func TestCompile_IfJumps(t *testing.T) {
+	tests := []struct {
+		src   string
+		jumps int
+	}{
+		{"var x = true\nif (x) {\n  x = 1\n}", 0},
+		{"var x = true\nif (x) {\n  x = 1\n} else if (x) {\n  x = 2\n}", 1},
+		{"var x = true\nif (x) {\n  x = 1\n} else if (x) {\n  x = 2\n} else {\n  x = 3\n}", 2},
+	}
+	for _, tt := range tests {
+		ins := compileSrc(t, tt.src).Instruction
+		jumps := 0
+		for i := 0; i < len(ins); i++ {
+			def := code.Definitions[code.Opcode(ins[i])]
+			operands, width := code.ReadOperand(def, ins[i+1:])
+			if code.Opcode(ins[i]) == code.OpJump {
+				jumps++
+				if operands[0] == i+1+width {
+					t.Errorf("%q: OpJump at %d jumps to the next instruction", tt.src, i)
+				}
+			}
+			i += width
+		}
+		if jumps != tt.jumps {
+			t.Errorf("%q: got %d OpJump, want %d", tt.src, jumps, tt.jumps)
+		}
+	}
+}
+
+// runParseCases 逐个解析用例, 比较整个程序的 Str() 或者第一个语法错误
+func runParseCases(t *testing.T, cases []evalCase) {
+	t.Helper()
+	for _, tc := range cases {
+		p := parser.NewParser(lexer.NewLexer(tc.src))
+		program := p.Parse()
+		errs := p.Errs()
+		if tc.err != "" {
+			if len(errs) == 0 || !strings.Contains(errs[0].Error(), tc.err) {
+				t.Errorf("%q: got errors %v, want %q", tc.src, errs, tc.err)
+			}
+			continue
+		}
+		if len(errs) != 0 {
+			t.Errorf("%q: unexpected errors %v", tc.src, errs)
+		} else if got := program.Str(); got != tc.want {
+			t.Errorf("%q parses to %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+// parseSrc 解析 src, 出现语法错误时测试失败
+func parseSrc(t *testing.T, src string) ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(src))
+	program := p.Parse().(ast.Program)
+	if p.HasError() {
+		t.Fatalf("%q: %v", src, p.Errs())
+	}
+	return program
+}
+
+// compileSrc 编译 src 并返回字节码, 解析或编译出错时测试失败
+func compileSrc(t *testing.T, src string) *bytecode.Bytecode {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(src))
+	program := p.Parse()
+	if p.HasError() {
+		t.Fatalf("%q: %v", src, p.Errs())
+	}
+	c := compiler.NewCompiler()
+	c.SetSymbol(p.SymTable)
+	c.Compile(program)
+	if c.HasError() {
+		t.Fatalf("%q: %v", src, c.Errs())
+	}
+	return c.ByteCode()
+}
+
+func TestParser_Labels(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "outer: for (x in [1]) { continue outer }", want: "outer: For (x in [1])Stmts:{Continue outer}"},
+		{src: "rows: for (var i = 0; i < 2; i = i + 1) { break rows }", want: "rows: For (Var i = 0;[i < 2];assign: i = [i + 1])Stmts:{Break rows}"},
+		{src: "a: var b = 1", err: "label a must be followed by a for loop"},
+	})
+}
+
+func TestParser_Lambda(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "(x) => x * 2", want: "Func: lambda#1(x)\n{Stmts:{=> [x * 2]}}"},
+		{src: "() => 7", want: "Func: lambda#1()\n{Stmts:{=> 7}}"},
+		{src: "var f = def (a, b) { return a + b }", want: "Var f = Func: lambda#1(a,b)\n{Stmts:{Return [a + b]}}"},
+		{src: "(x) => (y) => x + y", want: "Func: lambda#1(x)\n{Stmts:{=> Func: lambda#2(y)\n{Stmts:{=> [x + y]}}}}"},
+		{src: "((a, b) => a * b)(6, 7)", want: "Func: lambda#1(a,b)\n{Stmts:{=> [a * b]}}(6,7)"},
+		{src: "(1, 2)", err: `unexpected "," in parenthesized expression`},
+		{src: "(a, 1) => a", err: "lambda parameter must be an identifier"},
+	})
+}
+
+// opcodes 去掉操作数, 只保留指令序列中的操作码
+func opcodes(ins code.Instructions) []code.Opcode {
+	var ops []code.Opcode
+	for i := 0; i < len(ins); i++ {
+		op := code.Opcode(ins[i])
+		_, width := code.ReadOperand(code.Definitions[op], ins[i+1:])
+		ops = append(ops, op)
+		i += width
+	}
+	return ops
+}
+
+// opCase 编译 src, ops 是指令序列中必须按顺序出现的关键操作码, 中间可以夹杂其他指令
+type opCase struct {
+	src string
+	ops []code.Opcode
+}
+
+// runCompileCases 逐个编译用例, 检查关键操作码是否按顺序出现
+func runCompileCases(t *testing.T, cases []opCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if got := opcodes(compileSrc(t, tc.src).Instruction); !hasOps(got, tc.ops) {
+			t.Errorf("%q compiles to %v, want %v in order", tc.src, got, tc.ops)
+		}
+	}
+}
+
+// hasOps 判断 want 是否是 got 的子序列
+func hasOps(got, want []code.Opcode) bool {
+	for _, op := range got {
+		if len(want) > 0 && op == want[0] {
+			want = want[1:]
+		}
+	}
+	return len(want) == 0
+}
+
+func TestCompile_Closure(t *testing.T) {
+	src := "def counter() {\n  var count = 0\n  def inc() {\n    count += 1\n    return count\n  }\n  return () => inc() + count\n}\n" +
+		"def adder(a) {\n  return (b) => (c) => a + b + c\n}"
+	tests := []struct {
+		name string
+		free []object.FreeVar
+		ops  []code.Opcode
+	}{
+		{"counter", nil, []code.Opcode{code.OpConstant, code.OpSetLocal, code.OpClosure, code.OpSetLocal, code.OpClosure, code.OpReturnVal}},
+		{"inc", []object.FreeVar{{Local: true, Index: 0}}, []code.Opcode{code.OpGetFree, code.OpConstant, code.OpAdd, code.OpSetFree, code.OpGetFree, code.OpReturnVal}},
+		{"lambda#1", []object.FreeVar{{Local: true, Index: 1}, {Local: true, Index: 0}}, []code.Opcode{code.OpGetFree, code.OpCallFunc, code.OpGetFree, code.OpAdd, code.OpReturnVal}},
+		{"lambda#3", []object.FreeVar{{Local: false, Index: 0}, {Local: true, Index: 0}}, []code.Opcode{code.OpGetFree, code.OpGetFree, code.OpAdd, code.OpGetLocal, code.OpAdd, code.OpReturnVal}},
+	}
+	funcs := map[string]object.CompiledFunc{}
+	for _, obj := range compileSrc(t, src).Constants {
+		if fn, ok := obj.(object.CompiledFunc); ok {
+			funcs[fn.FnName] = fn
+		}
+	}
+	for _, tt := range tests {
+		fn, ok := funcs[tt.name]
+		if !ok {
+			t.Errorf("function %s not compiled", tt.name)
+			continue
+		}
+		if fmt.Sprint(fn.FreeVars) != fmt.Sprint(tt.free) {
+			t.Errorf("%s captures %v, want %v", tt.name, fn.FreeVars, tt.free)
+		}
+		if got := opcodes(fn.Instructions); !hasOps(got, tt.ops) {
+			t.Errorf("%s compiles to %v, want %v in order", tt.name, got, tt.ops)
+		}
+	}
+}
+
+func TestParser_DefaultsAndKeywords(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "def f(a, b = base, c = none) { return a }", want: "Func: f(a,b=base,c=None)\n{Stmts:{Return a}}"},
+		{src: "var g = def (x, y = 2) { return x }", want: "Var g = Func: lambda#1(x,y=2)\n{Stmts:{Return x}}"},
+		{src: "f(1, c = 3)", want: "f(1,c=3)"},
+		{src: "f(c = 3, a = 1)", want: "f(c=3,a=1)"},
+		{src: "f(a = 1, a = 2)", err: "keyword argument a repeated"},
+		{src: "f(a = 1, 2)", err: "positional argument follows keyword argument"},
+		{src: "def h(a = 1, b) { return b }", err: "non-default parameter b follows default parameter"},
+		{src: "f(1 = 2)", err: `expected "," or ")" but found "="`},
+	})
+}
+
+func TestCompile_Calls(t *testing.T) {
+	runCompileCases(t, []opCase{
+		{"def f(a) { return a }\nf(1)", []code.Opcode{code.OpClosure, code.OpConstant, code.OpCallFunc}},
+		{"def f(a, c = 1) { return a }\nf(1, c = 3)", []code.Opcode{code.OpDefaults, code.OpCallKw}},
+		{"def log(level, ...rest) { return rest }\nlog(1, 2)", []code.Opcode{code.OpConstant, code.OpConstant, code.OpCallFunc}},
+		{"def log(level, ...rest) { return rest }\nlog(0, ...[1], 2)", []code.Opcode{code.OpBuildArray, code.OpBuildArray, code.OpBuildArray, code.OpCallSpread}},
+	})
+}
+
+func TestParser_Variadic(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "def log(level, ...rest) { return rest }", want: "Func: log(level,...rest)\n{Stmts:{Return rest}}"},
+		{src: "var sum = def (...xs) { return xs }", want: "Var sum = Func: lambda#1(...xs)\n{Stmts:{Return xs}}"},
+		{src: "log(0, ...arr, 6)", want: "log(0,...arr,6)"},
+		{src: "def g(...xs, y) { return y }", err: "variadic parameter xs must be the last parameter"},
+		{src: "def g(a, ...) { return a }", err: `expected identifier but found ")"`},
+		{src: "f(...)", err: `unexpected ")"`},
+	})
+}
+
+func TestParser_Unpack(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "var a, b = 1, 2", want: "Var a, b = 1, 2"},
+		{src: "a, b = b, a", want: "assign: a, b = b, a"},
+		{src: "var x, [y, [z, w]] = 1, [2, [3, 4]]", want: "Var x, [y,[z,w]] = 1, [2,[3,4]]"},
+		{src: "var [m, n] = s", want: "Var [m,n] = s"},
+		{src: "var u, 1 = 1, 2", err: `cannot assign to "1"`},
+		{src: "a, b.c = 1, 2", err: `expected "=" but found "."`},
+	})
+}
+
+func TestCompile_Unpack(t *testing.T) {
+	runCompileCases(t, []opCase{
+		// 右边全部求值之后才赋值
+		{"var a, b = 1, 2\na, b = b, a", []code.Opcode{code.OpGetGlobal, code.OpGetGlobal, code.OpSetGlobal, code.OpSetGlobal}},
+		{"var p = [1, [2, 3]]\nvar x, [y, z] = p", []code.Opcode{code.OpUnpack, code.OpUnpack, code.OpSetGlobal}},
+	})
+}
+
+func TestParser_Conditional(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "1 if x else 2", want: "(1 if x else 2)"},
+		{src: "\"neg\" if n < 0 else \"zero\" if n == 0 else \"pos\"", want: "('neg' if [n < 0] else ('zero' if [n == 0] else 'pos'))"},
+		{src: "(n) => 1 if n else 2", want: "Func: lambda#1(n)\n{Stmts:{=> (1 if n else 2)}}"},
+		{src: "var x = 1 if true", err: `expected "else" but found end of file`},
+	})
+}
+
+func TestCompile_Conditional(t *testing.T) {
+	runCompileCases(t, []opCase{
+		{"var x = true\nvar y = 1 if x else 2", []code.Opcode{code.OpJumpNotTrue, code.OpConstant, code.OpJump, code.OpConstant}},
+	})
+}
+
+func TestParser_ShortCircuit(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "x or y and z", want: "[x Or [y And z]]"},
+		{src: "a and b or c", want: "[[a And b] Or c]"},
+		{src: "not a or b", want: "[[Not a] Or b]"},
+		{src: "x != none and len(x) > 0", want: "[[x != None] And [len(x) > 0]]"},
+	})
+}
+
+func TestCompile_ShortCircuit(t *testing.T) {
+	runCompileCases(t, []opCase{
+		{"var x = 1\nx or 2", []code.Opcode{code.OpJumpIfTrueOrPop, code.OpConstant}},
+		{"var x = 1\nx and 2", []code.Opcode{code.OpJumpIfFalseOrPop, code.OpConstant}},
+	})
+}
+
+func TestParser_CompareChain(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "0 <= i < n", want: "[0 <= i < n]"},
+		{src: "1 < 2 == true", want: "[1 < 2 == true]"},
+		{src: "(1 < 2) == true", want: "[[1 < 2] == true]"},
+		{src: "a not in b < c", want: "[a not in b < c]"},
+		{src: "a < b and c", want: "[[a < b] And c]"},
+		{src: "1 not 2", err: `expected "in" but found "2"`},
+	})
+	program := parseSrc(t, "1 < x == 2")
+	chain, ok := program.Statements[0].(ast.ExprStatement).Expression.(ast.CompareChain)
+	if !ok || len(chain.Operands) != 3 || len(chain.Ops) != 2 {
+		t.Errorf("1 < x == 2 parses to %#v, want a CompareChain of 3 operands", program.Statements[0])
+	}
+}
+
+func TestCompile_CompareChain(t *testing.T) {
+	runCompileCases(t, []opCase{
+		// 中间的操作数只求值一次, 复制后留给下一次比较
+		{"var x = 1\nx < 2 < 3", []code.Opcode{code.OpDup, code.OpGT, code.OpJumpNotTrue, code.OpGT}},
+	})
+}
+
+func TestParser_IndexAssign(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "a[0][1] = 1", want: "a[0][1] = 1"},
+		{src: "a[0] += 1", want: "a[0] += 1"},
+		{src: "a[k()][k()] -= x + 1", want: "a[k()][k()] -= [x + 1]"},
+		{src: "a[0]", want: "a[0]"},
+		{src: "f()[0][0] = 9", want: "f()[0][0] = 9"},
+		{src: "a.b()[0] += 1", want: "a.b()[0] += 1"},
+		{src: "[[7]][0][0] = 1", want: "[[7]][0][0] = 1"},
+		{src: "a[0](1) = 2", err: "cannot assign to a[0](1)"},
+		{src: "f() = 2", err: "cannot assign to f()"},
+	})
+	program := parseSrc(t, "grid[i][j] = 0")
+	stmt, ok := program.Statements[0].(ast.ExpressionAssign)
+	if !ok || stmt.Old.Str() != "grid[i]" || stmt.Key.Str() != "j" || stmt.Op != nil {
+		t.Errorf("grid[i][j] = 0 parses to %#v", program.Statements[0])
+	}
+}
+
+func TestCompile_IndexAssign(t *testing.T) {
+	runCompileCases(t, []opCase{
+		{"var a = [1]\na[0] = 2", []code.Opcode{code.OpUpdate, code.OpSetGlobal}},
+		{"var a = [[1]]\na[0][0] += 2", []code.Opcode{code.OpDup2, code.OpIndex, code.OpDup2, code.OpIndex, code.OpAdd, code.OpUpdate, code.OpUpdate, code.OpSetGlobal}},
+	})
+}
+
+func TestParser_MethodChains(t *testing.T) {
+	runParseCases(t, []evalCase{
+		{src: "s.strip().split(\",\")[0]", want: "s.strip().split(',')[0]"},
+		{src: "get_list().append(3)", want: "get_list().append(3)"},
+		{src: "\"a\".upper", err: `expected "(" but found end of file`},
+	})
+	program := parseSrc(t, "a[1].b(2).c()")
+	outer, ok := program.Statements[0].(ast.ExprStatement).Expression.(ast.MethodCall)
+	if !ok || outer.Method.Str() != "c" {
+		t.Fatalf("a[1].b(2).c() parses to %#v", program.Statements[0])
+	}
+	inner, ok := outer.Left.(ast.MethodCall)
+	if !ok || inner.Method.Str() != "b" || len(inner.Arguments) != 1 {
+		t.Fatalf("receiver of c() is %#v, want the call b(2)", outer.Left)
+	}
+	if _, ok := inner.Left.(ast.IndexExpression); !ok {
+		t.Errorf("receiver of b(2) is %#v, want a[1]", inner.Left)
+	}
+}
+
+func TestCompile_MethodChains(t *testing.T) {
+	runCompileCases(t, []opCase{
+		// 只有变量作为接收者时才写回, 中间结果调用方法后直接丢弃
+		{"var s = \"a\"\ns.upper().split(\",\")", []code.Opcode{code.OpCallMethod, code.OpSetGlobal, code.OpCallMethod, code.OpPop}},
+	})
+}
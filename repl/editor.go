@@ -0,0 +1,312 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupt 表示用户按下 Ctrl-C 放弃当前输入
+var errInterrupt = errors.New("interrupt")
+
+type completer func(prefix string) []string
+
+type editor interface {
+	ReadLine(prompt string) (string, error)
+	SetHistory(history []string)
+	IsTerminal() bool
+	Close() error
+}
+
+func newEditor(in *os.File, out io.Writer, complete completer) editor {
+	if _, err := getState(in.Fd()); err != nil {
+		return &plainEditor{reader: bufio.NewReader(in)}
+	}
+	return &termEditor{
+		fd:       in.Fd(),
+		reader:   bufio.NewReader(in),
+		out:      out,
+		complete: complete,
+	}
+}
+
+// plainEditor 用于输入不是终端的情况, 例如管道
+type plainEditor struct {
+	reader *bufio.Reader
+}
+
+func (e *plainEditor) ReadLine(_ string) (string, error) {
+	line, err := e.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (e *plainEditor) SetHistory(_ []string) {}
+
+func (e *plainEditor) IsTerminal() bool {
+	return false
+}
+
+func (e *plainEditor) Close() error {
+	return nil
+}
+
+// termEditor 在 raw 模式下读取按键, 支持光标移动、历史记录和 Tab 补全
+type termEditor struct {
+	fd       uintptr
+	reader   *bufio.Reader
+	out      io.Writer
+	complete completer
+
+	history []string
+	histIdx int
+	prompt  string
+	line    []rune
+	cursor  int
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyTab       = 9
+	keyEnter     = 13
+	keyNewline   = 10
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+func (e *termEditor) SetHistory(history []string) {
+	e.history = history
+}
+
+func (e *termEditor) IsTerminal() bool {
+	return true
+}
+
+func (e *termEditor) Close() error {
+	return nil
+}
+
+// ReadLine 只在读取输入期间进入 raw 模式, 执行代码时 Ctrl-C 仍可中断进程
+func (e *termEditor) ReadLine(prompt string) (string, error) {
+	orig, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore(e.fd, orig)
+	e.prompt = prompt
+	e.line = e.line[:0]
+	e.cursor = 0
+	e.histIdx = len(e.history)
+	var edited string // 浏览历史前正在编辑的内容
+	e.refresh()
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyEnter, keyNewline:
+			e.write("\r\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			e.write("^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case keyBackspace, keyCtrlH:
+			if e.cursor > 0 {
+				e.cursor--
+				e.delete()
+			}
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.line)
+		case keyCtrlK:
+			e.line = e.line[:e.cursor]
+		case keyCtrlU:
+			e.line = append(e.line[:0], e.line[e.cursor:]...)
+			e.cursor = 0
+		case keyCtrlW:
+			start := wordStart(e.line, e.cursor)
+			e.line = append(e.line[:start], e.line[e.cursor:]...)
+			e.cursor = start
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			switch e.escape() {
+			case "[A": // 上
+				if e.histIdx == len(e.history) {
+					edited = string(e.line)
+				}
+				if e.histIdx > 0 {
+					e.histIdx--
+					e.setLine(e.history[e.histIdx])
+				}
+			case "[B": // 下
+				if e.histIdx < len(e.history) {
+					e.histIdx++
+					if e.histIdx == len(e.history) {
+						e.setLine(edited)
+					} else {
+						e.setLine(e.history[e.histIdx])
+					}
+				}
+			case "[C": // 右
+				if e.cursor < len(e.line) {
+					e.cursor++
+				}
+			case "[D": // 左
+				if e.cursor > 0 {
+					e.cursor--
+				}
+			case "[H", "OH", "[1~":
+				e.cursor = 0
+			case "[F", "OF", "[4~":
+				e.cursor = len(e.line)
+			case "[3~":
+				e.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// escape 读取方向键等转义序列的剩余部分
+func (e *termEditor) escape() string {
+	var seq []rune
+	for len(seq) < 4 {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			break
+		}
+		seq = append(seq, r)
+		if len(seq) > 1 && (unicode.IsLetter(r) || r == '~') {
+			break
+		}
+	}
+	return string(seq)
+}
+
+func (e *termEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.cursor+1:], e.line[e.cursor:])
+	e.line[e.cursor] = r
+	e.cursor++
+}
+
+func (e *termEditor) delete() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+func (e *termEditor) setLine(s string) {
+	e.line = append(e.line[:0], []rune(s)...)
+	e.cursor = len(e.line)
+}
+
+func (e *termEditor) completeWord() {
+	start := wordStart(e.line, e.cursor)
+	if start == 1 && e.line[0] == ':' {
+		start = 0 // 补全 ":vars" 等命令
+	}
+	prefix := string(e.line[start:e.cursor])
+	candidates := e.complete(prefix)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		e.replaceWord(start, candidates[0])
+	default:
+		common := commonPrefix(candidates)
+		if len([]rune(common)) > len([]rune(prefix)) {
+			e.replaceWord(start, common)
+			return
+		}
+		e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	}
+}
+
+func (e *termEditor) replaceWord(start int, word string) {
+	tail := append([]rune{}, e.line[e.cursor:]...)
+	e.line = append(append(e.line[:start], []rune(word)...), tail...)
+	e.cursor = start + len([]rune(word))
+}
+
+func (e *termEditor) refresh() {
+	tail := displayWidth(e.line[e.cursor:])
+	s := "\r" + e.prompt + string(e.line) + "\x1b[K"
+	if tail > 0 {
+		s += fmt.Sprintf("\x1b[%dD", tail)
+	}
+	e.write(s)
+}
+
+func (e *termEditor) write(s string) {
+	_, _ = io.WriteString(e.out, s)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func wordStart(line []rune, cursor int) int {
+	start := cursor
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	return start
+}
+
+func commonPrefix(words []string) string {
+	prefix := []rune(words[0])
+	for _, w := range words[1:] {
+		rs := []rune(w)
+		n := 0
+		for n < len(prefix) && n < len(rs) && prefix[n] == rs[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// displayWidth 计算终端显示宽度, 中日韩等全角字符占两列
+func displayWidth(rs []rune) int {
+	width := 0
+	for _, r := range rs {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r) ||
+			unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+			(r >= 0xFF00 && r <= 0xFF60) || (r >= 0x3000 && r <= 0x303F) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,312 @@
+package repl
+
+import (
+	"Interpreter/bytecode"
+	"Interpreter/compiler"
+	xerrors "Interpreter/errors"
+	"Interpreter/lexer"
+	"Interpreter/parser"
+	"Interpreter/tokens"
+	"Interpreter/vm"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	Prompt     = ">>> "
+	MorePrompt = "... "
+	historyMax = 500
+)
+
+// Repl 在多次输入之间共享符号表、常量表和全局变量
+type Repl struct {
+	out       io.Writer
+	symTable  *parser.SymTable
+	constants *compiler.ConstTable
+	machine   *vm.VM
+	last      *bytecode.Bytecode
+	history   []string
+}
+
+func New(out io.Writer) *Repl {
+	r := &Repl{out: out}
+	r.Reset()
+	return r
+}
+
+// Reset 丢弃已定义的全部变量和函数
+func (r *Repl) Reset() {
+	r.symTable = parser.NewSymTable("Base")
+	r.constants = compiler.NewConstTable()
+	r.machine = vm.NewVM()
+	r.last = nil
+}
+
+// Eval 编译并执行一次输入, 最后一条表达式语句的值会被输出.
+// 解析或编译失败时撤销这次输入新增的符号和常量
+func (r *Repl) Eval(src string) []error {
+	if strings.TrimSpace(src) == "" {
+		return nil
+	}
+	restoreSyms, restoreConsts := r.symTable.Snapshot(), r.constants.Snapshot()
+	rollback := func(errs []error) []error {
+		restoreSyms()
+		restoreConsts()
+		return errs
+	}
+	lex := lexer.NewLexer(src)
+	p := parser.NewParserWithSymTable(lex, r.symTable)
+	program := p.Parse()
+	if errs := append(lex.Errs(), p.Errs()...); len(errs) > 0 {
+		return rollback(errs)
+	}
+	c := compiler.NewCompilerWithState(r.symTable, r.constants)
+	c.SetMode()
+	c.Compile(program)
+	if c.HasError() {
+		return rollback(c.Errs())
+	}
+	r.last = c.ByteCode()
+	if err := r.machine.Run(r.last); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Complete 返回可以补全 prefix 的关键字和已定义的名称
+func (r *Repl) Complete(prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+	seen := map[string]bool{}
+	var res []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	for _, s := range r.symTable.Symbols() {
+		add(s.Name)
+	}
+	for kw := range tokens.Reserved {
+		add(kw)
+	}
+	if strings.HasPrefix(prefix, ":") {
+		for _, cmd := range metaCommands {
+			add(cmd.name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// NeedMore 判断输入中的括号、三引号字符串或块注释是否尚未闭合
+func NeedMore(src string) bool {
+	if strings.TrimSpace(src) == "" {
+		return false
+	}
+	if strings.Count(src, `"""`)%2 == 1 || strings.Count(src, "'''")%2 == 1 {
+		return true
+	}
+	if strings.Count(src, "/*") > strings.Count(src, "*/") {
+		return true
+	}
+	depth := 0
+	lex := lexer.NewLexer(src)
+	for t := lex.NextToken(); !t.IsEOF(); t = lex.NextToken() {
+		switch t.Type {
+		case tokens.LParen, tokens.LBRACE, tokens.LBRACKET:
+			depth++
+		case tokens.RParen, tokens.RBRACE, tokens.RBRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+type metaCommand struct {
+	name, help string
+	run        func(r *Repl, arg string)
+}
+
+var metaCommands []metaCommand
+
+func init() {
+	metaCommands = []metaCommand{
+		{":help", "show this message", (*Repl).cmdHelp},
+		{":vars", "list global variables and their values", (*Repl).cmdVars},
+		{":disasm", "print the bytecode of the last input", (*Repl).cmdDisasm},
+		{":reset", "forget all variables and functions", (*Repl).cmdReset},
+		{":history", "show the input history", (*Repl).cmdHistory},
+		{":quit", "leave the session", nil},
+	}
+}
+
+func (r *Repl) cmdHelp(_ string) {
+	for _, cmd := range metaCommands {
+		fmt.Fprintf(r.out, "  %-10s %s\n", cmd.name, cmd.help)
+	}
+}
+
+func (r *Repl) cmdVars(_ string) {
+	for _, s := range r.symTable.Symbols() {
+		if s.ScopeType != parser.Global {
+			continue
+		}
+		switch obj := r.machine.Global(s.Id); {
+		case s.Type == parser.F:
+			fmt.Fprintf(r.out, "%s = <function %s>\n", s.Name, s.Name)
+		case obj == nil:
+			fmt.Fprintf(r.out, "%s = <unbound>\n", s.Name)
+		default:
+			fmt.Fprintf(r.out, "%s = %s\n", s.Name, obj.Inspect())
+		}
+	}
+}
+
+func (r *Repl) cmdDisasm(_ string) {
+	if r.last == nil {
+		fmt.Fprintln(r.out, "nothing has been compiled yet")
+		return
+	}
+	fmt.Fprint(r.out, r.last.Ins())
+}
+
+func (r *Repl) cmdReset(_ string) {
+	r.Reset()
+	fmt.Fprintln(r.out, "state cleared")
+}
+
+func (r *Repl) cmdHistory(_ string) {
+	for i, line := range r.history {
+		fmt.Fprintf(r.out, "%4d  %s\n", i+1, line)
+	}
+}
+
+// meta 执行以 ":" 开头的命令, 返回 false 表示退出
+func (r *Repl) meta(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	for _, cmd := range metaCommands {
+		if cmd.name != name {
+			continue
+		}
+		if cmd.run == nil {
+			return false
+		}
+		cmd.run(r, strings.TrimSpace(arg))
+		return true
+	}
+	fmt.Fprintf(r.out, "unknown command %s, try :help\n", name)
+	return true
+}
+
+// Start 运行交互循环直到输入结束或 :quit
+func (r *Repl) Start(in *os.File) {
+	editor := newEditor(in, r.out, r.Complete)
+	defer editor.Close()
+	if editor.IsTerminal() {
+		r.loadHistory()
+		defer r.saveHistory()
+	}
+	var buf []string
+	for {
+		prompt := Prompt
+		if len(buf) > 0 {
+			prompt = MorePrompt
+		}
+		editor.SetHistory(r.history)
+		line, err := editor.ReadLine(prompt)
+		if errors.Is(err, errInterrupt) {
+			buf = buf[:0]
+			continue
+		}
+		if err != nil {
+			if len(buf) > 0 {
+				src := strings.Join(buf, "\n")
+				r.report(src, r.Eval(src))
+			}
+			return
+		}
+		if strings.TrimSpace(line) != "" {
+			r.addHistory(line)
+		}
+		if len(buf) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "exit" {
+				return
+			}
+			if strings.HasPrefix(trimmed, ":") {
+				if !r.meta(trimmed) {
+					return
+				}
+				continue
+			}
+		}
+		buf = append(buf, line)
+		src := strings.Join(buf, "\n")
+		if NeedMore(src) {
+			continue
+		}
+		buf = buf[:0]
+		r.report(src, r.Eval(src))
+	}
+}
+
+// report 输出错误, 语法错误会附上出错的源码行
+func (r *Repl) report(src string, errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(r.out, xerrors.Render(err, src))
+	}
+}
+
+func (r *Repl) addHistory(line string) {
+	if n := len(r.history); n > 0 && r.history[n-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if len(r.history) > historyMax {
+		r.history = r.history[len(r.history)-historyMax:]
+	}
+}
+
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".xlang_history")
+}
+
+func (r *Repl) loadHistory() {
+	path := historyFile()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			r.addHistory(line)
+		}
+	}
+}
+
+func (r *Repl) saveHistory() {
+	path := historyFile()
+	if path == "" || len(r.history) == 0 {
+		return
+	}
+	var sb strings.Builder
+	for _, line := range r.history {
+		sb.WriteString(line + "\n")
+	}
+	_ = os.WriteFile(path, []byte(sb.String()), 0600)
+}
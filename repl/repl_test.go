@@ -0,0 +1,110 @@
+package repl
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepl_EvalKeepsState(t *testing.T) {
+	r := New(io.Discard)
+	inputs := []string{
+		"var a = 1",
+		"def f(x) {\n  return x + a\n}",
+		"a = a + 1",
+		"var b = f(10)",
+	}
+	for _, in := range inputs {
+		if errs := r.Eval(in); len(errs) > 0 {
+			t.Fatalf("Eval(%q) failed: %v", in, errs)
+		}
+	}
+	s, ok := r.symTable.Resolve("b")
+	if !ok {
+		t.Fatal("b is not defined")
+	}
+	if got := r.machine.Global(s.Id).Inspect(); got != "12" {
+		t.Errorf("b = %s, want 12", got)
+	}
+
+	r.Reset()
+	if errs := r.Eval("a"); len(errs) == 0 {
+		t.Error("a should be undefined after Reset")
+	}
+}
+
+func TestRepl_EvalRollsBackOnError(t *testing.T) {
+	r := New(io.Discard)
+	if errs := r.Eval("var a = 1"); len(errs) > 0 {
+		t.Fatalf("Eval failed: %v", errs)
+	}
+	for _, in := range []string{"var b = nope", "def g() { return nope }", "var c = (x) => x +"} {
+		if errs := r.Eval(in); len(errs) == 0 {
+			t.Fatalf("Eval(%q) should fail", in)
+		}
+	}
+	for _, name := range []string{"b", "g", "c"} {
+		if _, ok := r.symTable.Resolve(name); ok {
+			t.Errorf("%s is still defined after a failed input", name)
+		}
+		errs := r.Eval(name)
+		if len(errs) == 0 || !strings.Contains(errs[0].Error(), "undefined") {
+			t.Errorf("Eval(%q) = %v, want an undefined error", name, errs)
+		}
+	}
+	if errs := r.Eval("var b = a + 1\ndef g() { return b }\nvar c = g()"); len(errs) > 0 {
+		t.Fatalf("Eval failed: %v", errs)
+	}
+	s, _ := r.symTable.Resolve("c")
+	if got := r.machine.Global(s.Id).Inspect(); got != "2" {
+		t.Errorf("c = %s, want 2", got)
+	}
+}
+
+func TestRepl_Lambda(t *testing.T) {
+	r := New(io.Discard)
+	for _, in := range []string{"var f = (x) => x + 1", "var g = (x) => x * 10", "var a = f(1) + g(1)"} {
+		if errs := r.Eval(in); len(errs) > 0 {
+			t.Fatalf("Eval(%q) failed: %v", in, errs)
+		}
+	}
+	s, _ := r.symTable.Resolve("a")
+	if got := r.machine.Global(s.Id).Inspect(); got != "12" {
+		t.Errorf("a = %s, want 12", got)
+	}
+}
+
+func TestNeedMore(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"var a = 1", false},
+		{"def f(x) {", true},
+		{"def f(x) {\n return x\n}", false},
+		{"print(1,", true},
+		{"var s = \"{\"", false},
+		{"# {", false},
+		{`var s = """first`, true},
+		{"var s = \"\"\"first\nsecond\"\"\"", false},
+		{"var a = 1 /* note", true},
+		{"var a = 1 /* note\n */", false},
+	}
+	for _, tt := range tests {
+		if got := NeedMore(tt.src); got != tt.want {
+			t.Errorf("NeedMore(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRepl_Complete(t *testing.T) {
+	r := New(io.Discard)
+	r.Eval("var total = 1\nvar tmp = 2")
+	if got, want := r.Complete("t"), []string{"tmp", "total", "true", "type"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Complete(t) = %v, want %v", got, want)
+	}
+	if got, want := r.Complete(":v"), []string{":vars"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Complete(:v) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+
+package repl
+
+import "errors"
+
+type termState struct{}
+
+var errNoTerminal = errors.New("terminal mode is not supported on this platform")
+
+func getState(_ uintptr) (*termState, error) {
+	return nil, errNoTerminal
+}
+
+func restore(_ uintptr, _ *termState) error {
+	return nil
+}
+
+func makeRaw(_ uintptr) (*termState, error) {
+	return nil, errNoTerminal
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type termState struct {
+	termios syscall.Termios
+}
+
+func getState(fd uintptr) (*termState, error) {
+	var st termState
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios,
+		uintptr(unsafe.Pointer(&st.termios)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return &st, nil
+}
+
+func restore(fd uintptr, st *termState) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios,
+		uintptr(unsafe.Pointer(&st.termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw 关闭回显和行缓冲, 返回原来的终端状态; 输出处理保持不变
+func makeRaw(fd uintptr) (*termState, error) {
+	orig, err := getState(fd)
+	if err != nil {
+		return nil, err
+	}
+	raw := *orig
+	raw.termios.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.termios.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.termios.Cc[syscall.VMIN] = 1
+	raw.termios.Cc[syscall.VTIME] = 0
+	if err := restore(fd, &raw); err != nil {
+		return nil, err
+	}
+	return orig, nil
+}
@@ -3,27 +3,44 @@ package tokens
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 const (
-	Int    = "Int"
-	Float  = "Float"
-	String = "String"
+	Int     = "Int"
+	Float   = "Float"
+	String  = "String"
+	FString = "FString" // f"..." 插值字符串
 
 	Plus  = "Plus"  // +
 	Minus = "Minus" // -
 	Pow   = "Pow"   // **
 	Mul   = "Mul"   // *
 	Div   = "Div"   // /
+	FDiv  = "FDiv"  // //
 	Mod   = "Mod"   // %
 
+	BitAnd = "BitAnd" // &
+	BitOr  = "BitOr"  // |
+	BitXor = "BitXor" // ^
+	BitNot = "BitNot" // ~
+	Shl    = "Shl"    // <<
+	Shr    = "Shr"    // >>
+
 	IPlus  = "IPlus"  // +=
 	IMinus = "IMinus" // -=
 	IPow   = "IPow"   // **=
 	IMul   = "IMul"   // *=
 	IDiv   = "IDiv"   // /=
+	IFDiv  = "IFDiv"  // //=
 	IMod   = "IMod"   // %=
 
+	IBitAnd = "IBitAnd" // &=
+	IBitOr  = "IBitOr"  // |=
+	IBitXor = "IBitXor" // ^=
+	IShl    = "IShl"    // <<=
+	IShr    = "IShr"    // >>=
+
 	Equal = "Equal" // ==
 	NotEq = "NotEq" // !=
 	LT    = "LT"    // <
@@ -49,9 +66,14 @@ const (
 	If       = "If"
 	Else     = "Else"
 	Break    = "Break"
+	Continue = "Continue"
+	In       = "In"
+	NotIn    = "NotIn" // not in, 由解析器把两个 token 合成
 	Func     = "Func"
 	Return   = "Return"
 	Assign   = "Assign"
+	Arrow    = "Arrow"    // =>
+	Ellipsis = "Ellipsis" // ...
 
 	Ident = "Ident"
 
@@ -65,26 +87,102 @@ const (
 	Illegal = "Illegal"
 )
 
+// Compound 记录复合赋值运算符对应的二元运算符, 例如 += 对应 +
+var Compound = map[string]string{
+	IPlus:   Plus,
+	IMinus:  Minus,
+	IMul:    Mul,
+	IDiv:    Div,
+	IFDiv:   FDiv,
+	IMod:    Mod,
+	IPow:    Pow,
+	IBitAnd: BitAnd,
+	IBitOr:  BitOr,
+	IBitXor: BitXor,
+	IShl:    Shl,
+	IShr:    Shr,
+}
+
 var Reserved = map[string]string{
-	"var":    Var,
-	"for":    For,
-	"def":    Func,
-	"if":     If,
-	"else":   Else,
-	"return": Return,
-	"true":   True,
-	"false":  False,
-	"and":    And,
-	"or":     Or,
-	"not":    Not,
-	"none":   None,
-	"break":  Break,
+	"var":      Var,
+	"for":      For,
+	"def":      Func,
+	"if":       If,
+	"else":     Else,
+	"return":   Return,
+	"true":     True,
+	"false":    False,
+	"and":      And,
+	"or":       Or,
+	"not":      Not,
+	"none":     None,
+	"break":    Break,
+	"continue": Continue,
+	"in":       In,
+}
+
+// names 记录符号和关键字在源码中的写法, 字面量和标识符记录它们的种类, 用于错误信息
+var names = map[string]string{
+	Int:     "integer",
+	Float:   "float",
+	String:  "string",
+	FString: "f-string",
+	Ident:   "identifier",
+	LF:      "newline",
+	EOF:     "end of file",
+
+	Plus: `"+"`, Minus: `"-"`, Pow: `"**"`, Mul: `"*"`, Div: `"/"`, FDiv: `"//"`, Mod: `"%"`,
+	BitAnd: `"&"`, BitOr: `"|"`, BitXor: `"^"`, BitNot: `"~"`, Shl: `"<<"`, Shr: `">>"`,
+	IPlus: `"+="`, IMinus: `"-="`, IPow: `"**="`, IMul: `"*="`, IDiv: `"/="`, IFDiv: `"//="`, IMod: `"%="`,
+	IBitAnd: `"&="`, IBitOr: `"|="`, IBitXor: `"^="`, IShl: `"<<="`, IShr: `">>="`,
+	Equal: `"=="`, NotEq: `"!="`, LT: `"<"`, LTEq: `"<="`, GT: `">"`, GTEq: `">="`,
+	LParen: `"("`, RParen: `")"`, LBRACE: `"{"`, RBRACE: `"}"`, LBRACKET: `"["`, RBRACKET: `"]"`,
+	Assign: `"="`, Arrow: `"=>"`, Ellipsis: `"..."`, NotIn: `"not in"`,
+	Dot: `"."`, Colon: `":"`, Comma: `","`, Semi: `";"`,
+}
+
+func init() {
+	for literal, t := range Reserved {
+		names[t] = strconv.Quote(literal)
+	}
 }
 
+// Name 返回 token 类型在错误信息中的写法
+func Name(Type string) string {
+	if name, ok := names[Type]; ok {
+		return name
+	}
+	return Type
+}
+
+// Locate 是源码中的一个位置, Offset 为字节偏移, Line 和 Column 从 1 开始
 type Locate struct {
+	Offset       int
 	Column, Line int
 }
 
+// Span 是源码中的一段区间, End 指向最后一个字符之后
+type Span struct {
+	Start, End Locate
+}
+
+// Cover 返回同时包含 s 和 o 的最小区间, 空区间会被忽略
+func (s Span) Cover(o Span) Span {
+	if o == (Span{}) {
+		return s
+	}
+	if s == (Span{}) {
+		return o
+	}
+	if o.Start.Offset < s.Start.Offset {
+		s.Start = o.Start
+	}
+	if o.End.Offset > s.End.Offset {
+		s.End = o.End
+	}
+	return s
+}
+
 func NToken(Type string, Value string, loc *Locate) *Token {
 	return &Token{
 		Type:    Type,
@@ -96,7 +194,52 @@ func NToken(Type string, Value string, loc *Locate) *Token {
 type Token struct {
 	Type    string
 	Literal string
-	Loc     Locate
+	Loc     Locate  // 第一个字符的位置
+	End     Locate  // 最后一个字符之后的位置
+	Parts   []FPart // 插值字符串拆分后的各段
+
+	// 以下字段只在词法分析器开启 KeepTrivia 时填充
+	Raw      string   // 源码中的原始文本
+	Leading  []Trivia // 前导的空白和注释
+	Trailing []Trivia // 同一行内跟在后面的空白和注释, 包括注释结尾的换行
+}
+
+// FPart 是插值字符串中的一段, Expr 为 true 时 Text 为 {} 中表达式的源码
+type FPart struct {
+	Text string
+	Expr bool
+	Spec string // ":" 之后的格式说明
+	Loc  Locate // 表达式源码的起始位置
+}
+
+// 空白和注释的种类
+const (
+	Whitespace = "Whitespace"
+	Comment    = "Comment"
+	Newline    = "Newline" // 行注释结尾的换行, 不会生成 LF token
+)
+
+// Trivia 是不影响语法的源码片段
+type Trivia struct {
+	Type string
+	Text string
+}
+
+// Source 返回 token 连同前后 trivia 的原始文本, 把所有 token 的 Source 拼接起来即得到源码
+func (t *Token) Source() string {
+	var sb strings.Builder
+	for _, tr := range t.Leading {
+		sb.WriteString(tr.Text)
+	}
+	sb.WriteString(t.Raw)
+	for _, tr := range t.Trailing {
+		sb.WriteString(tr.Text)
+	}
+	return sb.String()
+}
+
+func (t *Token) Span() Span {
+	return Span{Start: t.Loc, End: t.End}
 }
 
 func (t *Token) Str() string {
@@ -116,6 +259,15 @@ func (t *Token) IsIllegal() bool {
 	return t.Type == Illegal
 }
 
+// Describe 返回 token 在错误信息中的写法, 字面量和标识符显示原文, 其余显示它们在源码中的写法
+func (t *Token) Describe() string {
+	switch t.Type {
+	case Int, Float, String, FString, Ident, Illegal:
+		return t.Quote()
+	}
+	return Name(t.Type)
+}
+
 func (t *Token) Quote() string {
 	return strconv.Quote(t.Literal)
 }
@@ -10,6 +10,10 @@ type Frame struct {
 	ip,
 	basePoint int
 	vars []object.Object
+	// free 是闭包捕获的变量
+	free []*object.Object
+	// spans 记录指令对应的源码区间
+	spans code.SpanTable
 }
 
 func NewFrame(ins code.Instructions, vars *[]object.Object, basePoint int) Frame {
@@ -3,6 +3,7 @@ package vm
 import (
 	"Interpreter/bytecode"
 	"Interpreter/code"
+	"Interpreter/errors"
 	"Interpreter/format"
 	"Interpreter/object"
 	"Interpreter/utils"
@@ -21,6 +22,7 @@ const (
 var (
 	StackOverErr = fmt.Errorf(format.Alert + "stack overflow")
 	StackIdxErr  = fmt.Errorf(format.Alert + "invalid index")
+	UnboundErr   = fmt.Errorf(format.Alert + "variable referenced before assignment")
 	NullObj      = object.Null{}
 )
 
@@ -44,6 +46,11 @@ func NewVM() *VM {
 	}
 }
 
+// Global 返回全局变量槽位 idx 中的值, 未赋值时为 nil
+func (vm *VM) Global(idx int) object.Object {
+	return vm.globals[idx]
+}
+
 func (vm *VM) LastPop() object.Object {
 	if vm.sp >= 0 {
 		return vm.stack[vm.sp]
@@ -86,14 +93,34 @@ func (vm *VM) replace(obj object.Object) error {
 }
 
 func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
+
+	vm.frames[0] = NewFrame(bytecode.Instruction, &vm.globals, 0)
+	vm.frames[0].spans = bytecode.Spans
+	vm.frameIdx = 1
+	vm.sp = 0
+	vm.constants = bytecode.Constants
+	if err := vm.run(bytecode); err != nil {
+		return vm.locate(err)
+	}
+	return nil
+}
+
+// locate 给运行时错误附上出错的指令在源码中的区间
+func (vm *VM) locate(err error) error {
+	frame := vm.currentFrame()
+	span, ok := frame.spans.Find(frame.ip)
+	if !ok {
+		return err
+	}
+	return errors.Diagnostic{Msg: err.Error(), Span: span}
+}
+
+func (vm *VM) run(bytecode *bytecode.Bytecode) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 	var varIdx uint16
 
-	vm.frames[0] = NewFrame(bytecode.Instruction, &vm.globals, 0)
-	vm.constants = bytecode.Constants
-
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
@@ -123,12 +150,13 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 			vm.pop()
 		case code.OpPrintTop:
 			vm.printTop()
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpPow, code.OpMod:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpFloorDiv, code.OpPow, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr:
 			err := vm.executeBinOp(op)
 			if err != nil {
 				return err
 			}
-		case code.OpPlus, code.OpMinus, code.OpNot:
+		case code.OpPlus, code.OpMinus, code.OpNot, code.OpBitNot:
 			err := vm.executePrefix(op)
 			if err != nil {
 				return err
@@ -138,11 +166,32 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 			if err != nil {
 				return err
 			}
-		case code.OpAnd, code.OpOr:
-			err := vm.logicBinOp(op)
+		case code.OpContains:
+			err := vm.contains()
 			if err != nil {
 				return err
 			}
+		case code.OpDup:
+			err := vm.push(vm.top())
+			if err != nil {
+				return err
+			}
+		case code.OpDup2:
+			for i := 0; i < 2; i++ {
+				err := vm.push(vm.stack[vm.sp-2])
+				if err != nil {
+					return err
+				}
+			}
+		case code.OpSwap:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+		case code.OpRot:
+			// n 为 3 时 [a b c] => [c a b]
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			top := vm.stack[vm.sp-1]
+			copy(vm.stack[vm.sp-n+1:vm.sp], vm.stack[vm.sp-n:vm.sp-1])
+			vm.stack[vm.sp-n] = top
 		case code.OpNull:
 			err := vm.push(NullObj)
 			if err != nil {
@@ -159,6 +208,14 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 			if !boolVal {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpJumpIfFalseOrPop, code.OpJumpIfTrueOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if objToNativeBool(vm.top()) == (op == code.OpJumpIfTrueOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
 		case code.OpSetGlobal:
 			varIdx = code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2 //skip the operand of code.OpSetGlobal
@@ -166,6 +223,9 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 		case code.OpGetGlobal:
 			varIdx = code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2 //skip the operand of code.OpGetGlobal
+			if vm.frames[0].vars[varIdx] == nil {
+				return UnboundErr
+			}
 			err := vm.push(vm.frames[0].vars[varIdx])
 			if err != nil {
 				return err
@@ -181,6 +241,22 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 			if err != nil {
 				return err
 			}
+		case code.OpCallKw:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			namesIdx := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+			err := vm.callKw(int(numArgs), vm.constants[namesIdx].(object.Array).Elements)
+			if err != nil {
+				return err
+			}
+		case code.OpCallSpread:
+			segments := code.ReadUint8(ins[ip+1:])
+			namesIdx := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+			err := vm.callSpread(int(segments), vm.constants[namesIdx].(object.Array).Elements)
+			if err != nil {
+				return err
+			}
 		case code.OpReturnVal:
 			returnVal := vm.pop()
 
@@ -198,6 +274,9 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 		case code.OpGetLocal:
 			varIdx = code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
+			if vm.currentFrame().vars[varIdx] == nil {
+				return UnboundErr
+			}
 			err := vm.push(vm.currentFrame().vars[varIdx])
 			if err != nil {
 				return err
@@ -214,12 +293,52 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 				return err
 			}
 		case code.OpClosure:
-			fnIdx := code.ReadUint8(ins[ip+1:])
+			fnIdx := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.pushClosure(vm.constants[fnIdx].(object.CompiledFunc))
+			if err != nil {
+				return err
+			}
+		case code.OpDefaults:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			defaults := make([]object.Object, n)
+			copy(defaults, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			var cl object.Closure
+			switch fn := vm.pop().(type) {
+			case object.CompiledFunc:
+				cl = object.Closure{Fn: fn}
+			case object.Closure:
+				cl = fn
+			}
+			cl.Defaults = defaults
+			err := vm.push(cl)
+			if err != nil {
+				return err
+			}
+		case code.OpUnpack:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			err := vm.unpack(n)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIdx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			err := vm.push(vm.constants[fnIdx])
+			cell := vm.currentFrame().free[freeIdx]
+			if *cell == nil {
+				return UnboundErr
+			}
+			err := vm.push(*cell)
 			if err != nil {
 				return err
 			}
+		case code.OpSetFree:
+			freeIdx := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			*vm.currentFrame().free[freeIdx] = vm.pop()
 		case code.OpBuildArray:
 			gap := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
@@ -232,6 +351,42 @@ func (vm *VM) Run(bytecode *bytecode.Bytecode) error {
 			if err != nil {
 				return err
 			}
+		case code.OpConcat:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			var sb strings.Builder
+			for i := vm.sp - n; i < vm.sp; i++ {
+				sb.WriteString(vm.stack[i].Inspect())
+			}
+			vm.sp -= n
+			err := vm.push(object.String{Value: []rune(sb.String())})
+			if err != nil {
+				return err
+			}
+		case code.OpFormat:
+			specIdx := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.formatTop(string(vm.constants[specIdx].(object.String).Value))
+			if err != nil {
+				return err
+			}
+		case code.OpGetIter:
+			iter, ok := object.NewIterator(vm.top())
+			if !ok {
+				return fmt.Errorf(format.Alert+"%s object is not iterable", vm.top().Type())
+			}
+			err := vm.replace(iter)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			n := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err := vm.iterNext(pos, n)
+			if err != nil {
+				return err
+			}
 		case code.OpMakeSlice:
 			sliceObj := object.Slice{}
 			sliceObj.Start = vm.stack[vm.sp-3]
@@ -303,15 +458,15 @@ func (vm *VM) callMethod(argsNum int) error {
 	}
 	returnObj := methodFunc.M(obj, args...)
 	vm.sp = vm.sp - argsNum - 2
-	var err error
-	if len(returnObj) >= 2 {
-		err = vm.push(returnObj[1]) //push returned value
-	}
-	err = vm.push(returnObj[0]) //push self
+	err := vm.push(returnObj[0]) //push self
 	if err != nil {
 		return err
 	}
-	return nil
+	var result object.Object = NullObj
+	if len(returnObj) >= 2 {
+		result = returnObj[1]
+	}
+	return vm.push(result) //push returned value
 }
 
 func (vm *VM) executeBinOp(op code.Opcode) error {
@@ -320,6 +475,9 @@ func (vm *VM) executeBinOp(op code.Opcode) error {
 	switch {
 	case right.Type() == object.IntObj && left.Type() == object.IntObj:
 		return vm.executeBinOpInt(op, left, right)
+	case bitwiseOps[op] != "":
+		return fmt.Errorf(format.Alert+"unsupported operand types for %s: %s and %s",
+			bitwiseOps[op], left.Type(), right.Type())
 	case right.Type() == object.StringObj || left.Type() == object.StringObj:
 		return vm.executeBinOpStr(op, left, right)
 	case right.Type() == object.FloatObj || left.Type() == object.FloatObj:
@@ -342,32 +500,97 @@ func (vm *VM) compareBinOp(op code.Opcode) error {
 	return vm.compareObj(op, left, right)
 }
 
-func (vm *VM) logicBinOp(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.top()
-	switch {
-	case left.Type() == object.BooleanObj && right.Type() == object.BooleanObj:
-		var res bool
-		leftVal := left.(object.Boolean).Value
-		rightVal := right.(object.Boolean).Value
-		switch op {
-		case code.OpAnd:
-			res = leftVal && rightVal
-		case code.OpOr:
-			res = leftVal || rightVal
+// contains 计算 item in container, item 在下, container 在栈顶
+func (vm *VM) contains() error {
+	container := vm.pop()
+	item := vm.top()
+	var res bool
+	switch container := container.(type) {
+	case object.String:
+		sub, ok := item.(object.String)
+		if !ok {
+			return fmt.Errorf(format.Alert+"'in <String>' requires String as left operand, not %s", item.Type())
+		}
+		res = strings.Contains(string(container.Value), string(sub.Value))
+	case object.Array:
+		for _, e := range container.Elements {
+			if objectsEqual(e, item) {
+				res = true
+				break
+			}
+		}
+	case object.Map:
+		// 不可哈希的对象哈希值相同, 需要再比较键本身
+		p, ok := container.Store[utils.Hash(item)]
+		res = ok && objectsEqual(p.Key, item)
+	case object.Range:
+		n, ok := item.(object.Int)
+		if ok && container.Len() > 0 {
+			offset := n.Value - container.Start
+			res = offset%container.Step == 0 && offset/container.Step >= 0 && offset/container.Step < container.Len()
 		}
-		return vm.replace(nativeBoolToBool(res))
 	default:
-		return fmt.Errorf(format.Alert+"unsporrted type %s", right.Type())
+		return fmt.Errorf(format.Alert+"argument of type %s is not iterable", container.Type())
+	}
+	return vm.replace(nativeBoolToBool(res))
+}
+
+// objectsEqual 与 == 的规则相同, Int 和 Float 按数值比较, Array 和 Map 逐个比较元素
+func objectsEqual(left, right object.Object) bool {
+	switch left := left.(type) {
+	case object.Int:
+		switch right := right.(type) {
+		case object.Int:
+			return left.Value == right.Value
+		case object.Float:
+			return float64(left.Value) == right.Value
+		}
+	case object.Float:
+		switch right := right.(type) {
+		case object.Int:
+			return left.Value == float64(right.Value)
+		case object.Float:
+			return left.Value == right.Value
+		}
+	case object.String:
+		if right, ok := right.(object.String); ok {
+			return string(left.Value) == string(right.Value)
+		}
+	case object.Array:
+		right, ok := right.(object.Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for i, e := range left.Elements {
+			if !objectsEqual(e, right.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case object.Map:
+		right, ok := right.(object.Map)
+		if !ok || len(left.Store) != len(right.Store) {
+			return false
+		}
+		for hash, lp := range left.Store {
+			rp, ok := right.Store[hash]
+			if !ok || !objectsEqual(lp.Key, rp.Key) || !objectsEqual(lp.Item, rp.Item) {
+				return false
+			}
+		}
+		return true
 	}
+	return left.Type() == right.Type() && utils.Hash(left) == utils.Hash(right)
 }
+
 func (vm *VM) compareObj(op code.Opcode, left, right object.Object) error {
 	var res bool
 	switch op {
+	// 不同类型的对象总是不相等, 例如 [] != none
 	case code.OpEqual:
-		res = utils.Hash(left) == utils.Hash(right)
+		res = objectsEqual(left, right)
 	case code.OpNotEQ:
-		res = utils.Hash(left) != utils.Hash(right)
+		res = !objectsEqual(left, right)
 	default:
 		return fmt.Errorf(format.Alert+"unsupport operator for object(%s,%s): %d", left.Inspect(),
 			right.Inspect(), op)
@@ -442,6 +665,8 @@ func objToNativeBool(obj object.Object) bool {
 			return false
 		}
 		return true
+	case object.Null:
+		return false
 	default:
 		return true
 	}
@@ -466,11 +691,41 @@ func (vm *VM) executeBinOpInt(op code.Opcode, left, right object.Object) error {
 			return DivZeroErr
 		}
 		return vm.replace(object.Float{Value: fRes})
+	case code.OpFloorDiv:
+		if rightVal == 0 {
+			return DivZeroErr
+		}
+		res = leftVal / rightVal
+		if (leftVal%rightVal != 0) && ((leftVal < 0) != (rightVal < 0)) {
+			res--
+		}
 	case code.OpMod:
+		if rightVal == 0 {
+			return DivZeroErr
+		}
+		// 与 // 配合, 余数的符号和除数相同
 		res = leftVal % rightVal
+		if res != 0 && (res < 0) != (rightVal < 0) {
+			res += rightVal
+		}
 	case code.OpPow:
 		fRes = math.Pow(float64(leftVal), float64(rightVal))
 		return vm.replace(object.Float{Value: fRes})
+	case code.OpBitAnd:
+		res = leftVal & rightVal
+	case code.OpBitOr:
+		res = leftVal | rightVal
+	case code.OpBitXor:
+		res = leftVal ^ rightVal
+	case code.OpShl, code.OpShr:
+		if rightVal < 0 {
+			return NegativeShiftErr
+		}
+		if op == code.OpShl {
+			res = leftVal << rightVal
+		} else {
+			res = leftVal >> rightVal
+		}
 	default:
 		return fmt.Errorf(format.Alert+"unknown integer operator: %d", op)
 	}
@@ -478,6 +733,17 @@ func (vm *VM) executeBinOpInt(op code.Opcode, left, right object.Object) error {
 }
 
 var DivZeroErr = fmt.Errorf(format.Alert + "division by zero")
+var NegativeShiftErr = fmt.Errorf(format.Alert + "negative shift count")
+
+// bitwiseOps 记录只能用于整数的位运算, 用于生成错误信息
+var bitwiseOps = map[code.Opcode]string{
+	code.OpBitAnd: "&",
+	code.OpBitOr:  "|",
+	code.OpBitXor: "^",
+	code.OpShl:    "<<",
+	code.OpShr:    ">>",
+	code.OpBitNot: "~",
+}
 
 func (vm *VM) executeBinOpFloat(op code.Opcode, left, right object.Object) error {
 	var leftVal float64
@@ -508,8 +774,19 @@ func (vm *VM) executeBinOpFloat(op code.Opcode, left, right object.Object) error
 		} else {
 			return DivZeroErr
 		}
+	case code.OpFloorDiv:
+		if rightVal == 0 {
+			return DivZeroErr
+		}
+		res = math.Floor(leftVal / rightVal)
 	case code.OpMod:
+		if rightVal == 0 {
+			return DivZeroErr
+		}
 		res = math.Mod(leftVal, rightVal)
+		if res != 0 && (res < 0) != (rightVal < 0) {
+			res += rightVal
+		}
 	case code.OpPow:
 		res = math.Pow(leftVal, rightVal)
 	default:
@@ -529,8 +806,36 @@ func (vm *VM) executeBinOpStr(op code.Opcode, left, right object.Object) error {
 	}
 }
 
+// formatTop 按格式说明把栈顶的值转换为字符串
+func (vm *VM) formatTop(spec string) error {
+	obj := vm.top()
+	var value interface{}
+	switch obj := obj.(type) {
+	case object.Int:
+		value = obj.Value
+	case object.Float:
+		value = obj.Value
+	case object.String:
+		value = string(obj.Value)
+	default:
+		value = obj.Inspect()
+	}
+	s, err := format.Spec(value, spec)
+	if err != nil {
+		return fmt.Errorf(format.Alert+"%s", err)
+	}
+	return vm.replace(object.String{Value: []rune(s)})
+}
+
 func (vm *VM) executePrefix(op code.Opcode) error {
 	token := vm.top()
+	// not 与 and, or 以及条件跳转使用相同的真值规则
+	if op == code.OpNot {
+		return vm.replace(nativeBoolToBool(!objToNativeBool(token)))
+	}
+	if op == code.OpBitNot && token.Type() != object.IntObj {
+		return fmt.Errorf(format.Alert+"bad operand type for unary ~: %s", token.Type())
+	}
 	switch token.Type() {
 	case object.IntObj:
 		value := token.(object.Int).Value
@@ -538,6 +843,8 @@ func (vm *VM) executePrefix(op code.Opcode) error {
 		case code.OpMinus:
 			value = -value
 		case code.OpPlus:
+		case code.OpBitNot:
+			value = ^value
 		default:
 			return fmt.Errorf(format.Alert+"unkonwn opCode %s for %s", string(op), token.Type())
 		}
@@ -552,14 +859,6 @@ func (vm *VM) executePrefix(op code.Opcode) error {
 			return fmt.Errorf(format.Alert+"unkonwn opCode %s for %s", string(op), token.Type())
 		}
 		return vm.replace(object.Float{Value: value})
-	case object.BooleanObj:
-		value := token.(object.Boolean).Value
-		if op == code.OpNot {
-			value = !value
-		} else {
-			return fmt.Errorf(format.Alert+"unkonwn opCode %s for %s", string(op), token.Type())
-		}
-		return vm.replace(nativeBoolToBool(value))
 	}
 	return fmt.Errorf(format.Alert+"unsupported type for negation: %s", token.Type())
 }
@@ -712,11 +1011,12 @@ func (vm *VM) handleSlice(s object.Slice, maxLen int) (start, end, step int) {
 	return
 }
 
+// arrayUpdate 执行 container[key] = value, 栈上依次是 container, key 和 value, 完成后压入 container
 func (vm *VM) arrayUpdate() error {
+	target := vm.pop()
 	key := vm.pop()
 	array := vm.pop()
 	var idxI int
-	target := vm.pop()
 	var pointer *object.Array
 	switch array := array.(type) {
 	case object.Array:
@@ -747,6 +1047,7 @@ func (vm *VM) arrayUpdate() error {
 				Item: target,
 			}
 			array.Store[idxI] = newPair
+			array.Keys = append(array.Keys, idxI)
 			array.Size++
 		} else {
 			p.Item = target
@@ -762,11 +1063,26 @@ func (vm *VM) arrayUpdate() error {
 	return nil
 }
 
-func (vm *VM) makeMap(keyLen int) error {
-	mapObj := object.Map{
-		Store: map[int]object.MapPair{},
-		Size:  keyLen / 2,
+// iterNext 把迭代器的下一个值压栈, n 为 2 时先压入 key, 迭代结束时跳转到 pos
+func (vm *VM) iterNext(pos int, n uint8) error {
+	iter := vm.top().(object.Iterator)
+	key, value, ok := iter.Next()
+	if !ok {
+		vm.currentFrame().ip = pos - 1
+		return nil
+	}
+	if n == 2 {
+		if err := vm.push(key); err != nil {
+			return err
+		}
+	} else if iter.ByKey {
+		value = key
 	}
+	return vm.push(value)
+}
+
+func (vm *VM) makeMap(keyLen int) error {
+	mapObj := object.NewMap()
 	if keyLen == 0 {
 		err := vm.push(mapObj)
 		if err != nil {
@@ -781,9 +1097,13 @@ func (vm *VM) makeMap(keyLen int) error {
 			Item: vm.stack[idx+1],
 		}
 		hash := utils.Hash(p.Key)
+		if _, ok := mapObj.Store[hash]; !ok {
+			mapObj.Keys = append(mapObj.Keys, hash)
+		}
 		mapObj.Store[hash] = p
 		idx += 2
 	}
+	mapObj.Size = len(mapObj.Keys)
 	vm.sp -= keyLen
 	err := vm.push(mapObj)
 	if err != nil {
@@ -810,6 +1130,8 @@ func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case object.CompiledFunc:
+		return vm.callFunc(object.Closure{Fn: callee}, numArgs)
+	case object.Closure:
 		return vm.callFunc(callee, numArgs)
 	case object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
@@ -819,36 +1141,216 @@ func (vm *VM) executeCall(numArgs int) error {
 }
 
 func (vm *VM) printTop() {
-	topObj := vm.top()
-	if topObj != nil {
+	topObj := vm.pop()
+	if topObj.Type() != object.NullObj {
 		printFn := object.GetBuiltinFn("print")
 		printFn.Fn(topObj)
-		vm.sp = vm.sp - 2
 	}
 }
 
-func (vm *VM) callFunc(fn object.CompiledFunc, numArgs int) error {
-	if numArgs != fn.ParametersNum {
-		return fmt.Errorf(format.Alert+"wrong number of arguments: want=%d, got=%d",
-			fn.ParametersNum, numArgs)
+// pushClosure 创建函数对象, 捕获的变量取自当前帧的局部变量或当前闭包
+func (vm *VM) pushClosure(fn object.CompiledFunc) error {
+	if len(fn.FreeVars) == 0 {
+		return vm.push(fn)
+	}
+	frame := vm.currentFrame()
+	free := make([]*object.Object, len(fn.FreeVars))
+	for i, v := range fn.FreeVars {
+		if v.Local {
+			free[i] = &frame.vars[v.Index]
+		} else {
+			free[i] = frame.free[v.Index]
+		}
+	}
+	return vm.push(object.Closure{Fn: fn, Free: free})
+}
+
+func (vm *VM) callFunc(cl object.Closure, numArgs int) error {
+	fn := cl.Fn
+	// 多余的位置参数留在栈上, 之后复制到 ...rest 中. 有多余参数时不会再压入默认值, 它们不会被覆盖
+	var extra []object.Object
+	if numArgs > fn.ParametersNum {
+		if !fn.Variadic {
+			return fmt.Errorf(format.Alert+"%s() takes %d positional argument(s) but %d were given",
+				fn.FnName, fn.ParametersNum, numArgs)
+		}
+		extra = vm.stack[vm.sp-numArgs+fn.ParametersNum : vm.sp]
+		vm.sp -= numArgs - fn.ParametersNum
+		numArgs = fn.ParametersNum
+	}
+	// 缺少的参数用默认值补齐
+	first := fn.ParametersNum - len(cl.Defaults)
+	if numArgs < first {
+		return fmt.Errorf(format.Alert+"%s() missing required argument %q", fn.FnName, fn.ParamNames[numArgs])
+	}
+	for ; numArgs < fn.ParametersNum; numArgs++ {
+		err := vm.push(cl.Defaults[numArgs-first])
+		if err != nil {
+			return err
+		}
 	}
 	newVars := make([]object.Object, fn.LocalsNum)
 	for idx, arg := range vm.stack[vm.sp-numArgs : vm.sp] {
 		newVars[idx] = arg
 	}
-	vm.pushFrame(NewFrame(fn.Instructions, &newVars, vm.sp-numArgs))
+	if fn.Variadic {
+		rest := make([]object.Object, len(extra))
+		copy(rest, extra)
+		newVars[numArgs] = object.Array{Elements: rest}
+	}
+	frame := NewFrame(fn.Instructions, &newVars, vm.sp-numArgs)
+	frame.free = cl.Free
+	frame.spans = fn.Spans
+	vm.pushFrame(frame)
 	return nil
 }
 
+// callKw 处理带关键字参数的调用, 栈上依次是函数, 位置参数和按 names 顺序排列的关键字参数,
+// 按参数名把它们排成位置参数后再调用
+func (vm *VM) callKw(numArgs int, names []object.Object) error {
+	base := vm.sp - numArgs
+	nPos := numArgs - len(names)
+	var fnName string
+	var params []string
+	var defaults []object.Object
+	var variadic bool
+	switch callee := vm.stack[base-1].(type) {
+	case object.CompiledFunc:
+		fnName, params, variadic = callee.FnName, callee.ParamNames, callee.Variadic
+	case object.Closure:
+		fnName, params, defaults = callee.Fn.FnName, callee.Fn.ParamNames, callee.Defaults
+		variadic = callee.Fn.Variadic
+	case object.Builtin:
+		fnName, params = callee.Name, callee.Params
+	default:
+		return fmt.Errorf(format.Alert+"calling non-function and non-built-in (type %s)", callee.Type())
+	}
+	var extra []object.Object
+	if nPos > len(params) {
+		if !variadic {
+			return fmt.Errorf(format.Alert+"%s() takes %d positional argument(s) but %d were given",
+				fnName, len(params), nPos)
+		}
+		extra = append(extra, vm.stack[base+len(params):base+nPos]...)
+		nPos = len(params)
+	}
+	args := make([]object.Object, len(params))
+	copy(args, vm.stack[base:base+nPos])
+	for i, n := range names {
+		name := string(n.(object.String).Value)
+		idx := -1
+		for j, param := range params {
+			if param == name {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf(format.Alert+"%s() got an unexpected keyword argument %q", fnName, name)
+		}
+		if args[idx] != nil {
+			return fmt.Errorf(format.Alert+"%s() got multiple values for argument %q", fnName, name)
+		}
+		args[idx] = vm.stack[base+nPos+i]
+	}
+	first := len(params) - len(defaults)
+	for i := first; i < len(args); i++ {
+		if args[i] == nil {
+			args[i] = defaults[i-first]
+		}
+	}
+	// 内置函数末尾缺少的参数交给函数自己处理
+	n := len(args)
+	if _, ok := vm.stack[base-1].(object.Builtin); ok {
+		for n > 0 && args[n-1] == nil {
+			n--
+		}
+	}
+	for i := 0; i < n; i++ {
+		if args[i] == nil {
+			return fmt.Errorf(format.Alert+"%s() missing required argument %q", fnName, params[i])
+		}
+	}
+	args = append(args[:n], extra...)
+	copy(vm.stack[base:], args)
+	vm.sp = base + len(args)
+	return vm.executeCall(len(args))
+}
+
+// callSpread 处理带 ...expr 的调用, 栈上依次是函数, 若干段可迭代的位置参数和关键字参数,
+// 展开后按普通调用或关键字调用执行
+func (vm *VM) callSpread(segments int, names []object.Object) error {
+	kwBase := vm.sp - len(names)
+	var args []object.Object
+	for _, seg := range vm.stack[kwBase-segments : kwBase] {
+		elements, ok := elementsOf(seg)
+		if !ok {
+			return fmt.Errorf(format.Alert+"argument after ... must be iterable, not %s", seg.Type())
+		}
+		args = append(args, elements...)
+	}
+	args = append(args, vm.stack[kwBase:vm.sp]...)
+	vm.sp = kwBase - segments
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	if len(names) == 0 {
+		return vm.executeCall(len(args))
+	}
+	return vm.callKw(len(args), names)
+}
+
+// unpack 弹出栈顶的值, 把它的 n 个元素依次压栈
+func (vm *VM) unpack(n int) error {
+	obj := vm.pop()
+	elements, ok := elementsOf(obj)
+	if !ok {
+		return fmt.Errorf(format.Alert+"cannot unpack non-iterable %s object", obj.Type())
+	}
+	if len(elements) != n {
+		return fmt.Errorf(format.Alert+"cannot unpack %d values into %d variables", len(elements), n)
+	}
+	for _, e := range elements {
+		err := vm.push(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elementsOf 返回可迭代对象的全部元素, Map 得到的是键
+func elementsOf(obj object.Object) ([]object.Object, bool) {
+	if arr, ok := obj.(object.Array); ok {
+		return arr.Elements, true
+	}
+	iter, ok := object.NewIterator(obj)
+	if !ok {
+		return nil, false
+	}
+	var elements []object.Object
+	for {
+		key, value, ok := iter.Next()
+		if !ok {
+			return elements, true
+		}
+		if iter.ByKey {
+			value = key
+		}
+		elements = append(elements, value)
+	}
+}
+
 func (vm *VM) callBuiltin(builtin object.Builtin, argNums int) error {
-	args = args[:0]
-	args = vm.stack[vm.sp-argNums : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Fn(vm.stack[vm.sp-argNums : vm.sp]...)
 	vm.sp = vm.sp - argNums - 1
-	if result != nil {
-		return vm.push(result)
+	if result == nil {
+		result = NullObj
 	}
-	return nil
+	return vm.push(result)
 }
 
 func (vm *VM) debug(operandWidth int) {
@@ -2,10 +2,12 @@ package main
 
 import (
 	"Interpreter/compiler"
+	"Interpreter/errors"
 	"Interpreter/lexer"
 	"Interpreter/parser"
 	vm2 "Interpreter/vm"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -16,6 +18,7 @@ func TestAll(t *testing.T) {
 	p := parser.NewParser(l)
 	nodes := p.Parse()
 	comp := compiler.NewCompiler()
+	comp.SetSymbol(p.SymTable)
 	comp.Compile(nodes)
 	vm := vm2.NewVM()
 	fmt.Println(comp.ByteCode().Instruction, comp.ByteCode().Constants)
@@ -25,3 +28,421 @@ func TestAll(t *testing.T) {
 	}
 	fmt.Println(vm.LastPop().Inspect())
 }
+
+// eval 运行 src 并返回最后一条表达式语句的值
+func eval(src string) (string, error) {
+	p := parser.NewParser(lexer.NewLexer(src))
+	nodes := p.Parse()
+	if p.HasError() {
+		return "", p.Errs()[0]
+	}
+	comp := compiler.NewCompiler()
+	comp.SetSymbol(p.SymTable)
+	comp.Compile(nodes)
+	if comp.HasError() {
+		return "", comp.Errs()[0]
+	}
+	vm := vm2.NewVM()
+	if err := vm.Run(comp.ByteCode()); err != nil {
+		return "", err
+	}
+	return vm.LastPop().Inspect(), nil
+}
+
+// evalCase 是一个求值用例, err 不为空时期望求值出错并且错误信息包含 err
+type evalCase struct {
+	src, want, err string
+}
+
+// runCases 逐个求值用例, 比较最后一条表达式语句的值或者错误信息
+func runCases(t *testing.T, cases []evalCase) {
+	t.Helper()
+	for _, tc := range cases {
+		got, err := eval(tc.src)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: got error %v, want %q", tc.src, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%q = %s (%v), want %s", tc.src, got, err, tc.want)
+		}
+	}
+}
+
+func TestBitwise(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "0b1100 & 0b1010", want: "8"},
+		{src: "0b1100 | 0b1010", want: "14"},
+		{src: "0b1100 ^ 0b1010", want: "6"},
+		{src: "~5", want: "-6"},
+		{src: "1 << 4", want: "16"},
+		{src: "-17 >> 2", want: "-5"},
+		{src: "1 + 1 << 2", want: "8"},
+		{src: "1 | 6 & 3", want: "3"},
+		{src: "1 | 2 == 3", want: "true"},
+		{src: "var f = 1\nf |= 6\nf <<= 1\nf ^= 2\nf &= 0xC\nf >>= 2\nf", want: "3"},
+		{src: "1.0 & 1", err: "unsupported operand types for &: Float and Int"},
+		{src: "1 | 2.5", err: "unsupported operand types for |: Int and Float"},
+		{src: "~1.5", err: "bad operand type for unary ~: Float"},
+		{src: "1 << -1", err: "negative shift count"},
+		{src: `"a" ^ 1`, err: "unsupported operand types for ^: String and Int"},
+	})
+}
+
+func TestFloorDiv(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "7 // 2", want: "3"},
+		{src: "-7 // 2", want: "-4"},
+		{src: "7 // -2", want: "-4"},
+		{src: "-7 // -2", want: "3"},
+		{src: "7 % 3", want: "1"},
+		{src: "-7 % 3", want: "2"},
+		{src: "7 % -3", want: "-2"},
+		{src: "-7 % -3", want: "-1"},
+		{src: "7.5 // 2", want: "3"},
+		{src: "-7.5 // 2", want: "-4"},
+		{src: "-7.5 % 2", want: "0.5"},
+		{src: "var a = 17\na //= 5\na", want: "3"},
+		{src: "var a = -17\nvar b = 5\na // b * b + a % b", want: "-17"},
+		{src: "7 // 2 % 3", want: "0"},
+		{src: "2 * 3 % 4", want: "2"},
+		{src: "7 % 4 * 3", want: "9"},
+		{src: "17 % 5 // 2", want: "1"},
+		{src: "2 ** 3 % 5", want: "3"},
+		{src: "1 + 7 % 4 * 2", want: "7"},
+		{src: "1 // 0", err: "division by zero"},
+		{src: "1 % 0", err: "division by zero"},
+		{src: "1.5 // 0", err: "division by zero"},
+		{src: "1.5 % 0", err: "division by zero"},
+	})
+}
+
+func TestFString(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: `var a = 1` + "\n" + `var b = 2.5` + "\n" + `f"total={a + b}"`, want: "total=3.5"},
+		{src: `var m = {"name": "ann"}` + "\n" + `f"name={m['name']}!"`, want: "name=ann!"},
+		{src: `f"{3.14159:.2f}|{42:>5}|{'ab':*<4}|{255:#x}"`, want: "3.14|   42|ab**|0xff"},
+		{src: `f"{{}} {[1, 2][0]}"`, want: "{} 1"},
+		{src: `f""`, want: ""},
+		{src: `def f(x) { return f"<{x}>" }` + "\n" + `f(7)`, want: "<7>"},
+		{src: `f"{1:.2d}"`, err: "precision not allowed in integer format specifier"},
+		{src: `f"{undefined}"`, err: `undefined Identifier "undefined"`},
+		{src: `f"{1 2}"`, err: `invalid expression "1 2" in f-string`},
+	})
+}
+
+func TestElseIf(t *testing.T) {
+	grade := `def grade(n) {
+  if (n >= 90) {
+    return "A"
+  } else if (n >= 80) {
+    return "B"
+  }
+  else if (n >= 70) {
+    return "C"
+  } else {
+    return "F"
+  }
+}
+`
+	runCases(t, []evalCase{
+		{src: grade + "grade(95)", want: "A"},
+		{src: grade + "grade(85)", want: "B"},
+		{src: grade + "grade(75)", want: "C"},
+		{src: grade + "grade(5)", want: "F"},
+		{src: "var x = 0\nif (x == 1) { x = 10 } else if (x == 0) { x = 20 }\nx", want: "20"},
+		{src: "var x = 3\nif (x == 1) { x = 10 } else if (x == 2) { x = 20 }\nx", want: "3"},
+		{src: "def f(n) {\n if (n == 1) { return 1 } else if (n == 2) { return 2 }\n}\nf(3)", want: "None"},
+		{src: "if (1) { 1 } else 2", err: `expected "{" but found "2"`},
+		{src: "if (1) { 1 }\n\nelse { 2 }", err: `unexpected "else"`},
+	})
+}
+
+func TestForIn(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var s = 0\nfor (x in [1, 2, 3]) { s += x }\ns", want: "6"},
+		{src: "var s = 0\nfor (i, x in [5, 6, 7]) { s += i * x }\ns", want: "20"},
+		{src: `var s = ""` + "\nfor (ch in \"héllo\") { s = ch + s }\ns", want: "olléh"},
+		{src: `var s = ""` + "\nfor (k in {\"b\": 2, \"a\": 1, \"c\": 3}) { s += k }\ns", want: "bac"},
+		{src: "var s = 0\nfor (k, v in {1: 10, 2: 20}) { s += k * v }\ns", want: "50"},
+		{src: "var m = {\"b\": 2, \"a\": 1}\nm[\"z\"] = 26\nm[\"b\"] = 3\nm", want: `{"b": 3, "a": 1, "z": 26}`},
+		{src: "var s = 0\nfor (i in range(10)) {\n  if (i == 5) { break }\n  s += i\n}\ns", want: "10"},
+		{src: "var s = []\nfor (i in range(10, 0, -3)) { s.append(i) }\ns", want: "[10, 7, 4, 1]"},
+		{src: "[len(range(5)), len(range(1, 10, 3)), len(range(5, 1))]", want: "[5, 3, 0]"},
+		{src: "def total(xs) {\n  var acc = 0\n  for (v in xs) { acc += v }\n  return acc\n}\ntotal(range(101))", want: "5050"},
+		{src: "var s = 0\nfor (a in [[1, 2], [3]]) {\n  for (b in a) { s += b }\n}\ns", want: "6"},
+		{src: "for (x in 5) { x }", err: "Int object is not iterable"},
+	})
+}
+
+func TestMapAliasing(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var a = {\"x\": 1}\nvar b = a\nb[\"y\"] = 2\n[a, len(a), \"y\" in a]", want: `[{"x": 1, "y": 2}, 2, true]`},
+		{src: "var a = {}\ndef put(m) {\n  m[\"k\"] = 1\n}\nput(a)\nvar s = \"\"\nfor (k in a) { s += k }\ns", want: "k"},
+		{src: "var c = [{}]\nvar m = c[0]\nc[0][\"q\"] = 5\nm", want: `{"q": 5}`},
+	})
+}
+
+func TestContinueAndLabels(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var s = []\nfor (var i = 0; i < 6; i += 1) {\n  if (i % 2 == 0) { continue }\n  s.append(i)\n}\ns", want: "[1, 3, 5]"},
+		{src: "var s = []\nfor (x in range(6)) {\n  if (x % 3 == 0) { continue }\n  s.append(x)\n}\ns", want: "[1, 2, 4, 5]"},
+		{src: `var r = []
+outer: for (a in range(4)) {
+  for (b in range(4)) {
+    if (b == a) { continue outer }
+    if (a == 3) { break outer }
+    r.append(a * 10 + b)
+  }
+}
+r`, want: "[10, 20, 21]"},
+		{src: `var n = 0
+rows: for (var i = 0; i < 3000; i += 1) {
+  for (x in [1, 2]) {
+    for (y in "ab") {
+      if (x == 2) { continue rows }
+      n += 1
+    }
+  }
+}
+n`, want: "6000"},
+		{src: `var n = 0
+for (i in range(3000)) {
+  inner: for (x in [1, 2]) {
+    for (y in "ab") { break inner }
+  }
+  n += 1
+}
+n`, want: "3000"},
+		{src: "break", err: `"break" outside loop`},
+		{src: "continue", err: `"continue" outside loop`},
+		{src: "for (x in [1]) {\n  def f() { break }\n}", err: `"break" outside loop`},
+		{src: "for (x in [1]) { continue nope }", err: `undefined loop label "nope"`},
+		{src: "a: var b = 1", err: "label a must be followed by a for loop"},
+	})
+}
+
+func TestLambda(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var double = (x) => x * 2\ndouble(21)", want: "42"},
+		{src: "var add = def (a, b) { return a + b }\nadd(1, 2)", want: "3"},
+		{src: "var fs = [(x) => x + 1, (x) => x * x, () => 7]\n[fs[0](1), fs[1](5), fs[2]()]", want: "[2, 25, 7]"},
+		{src: "var ops = {\"+\": (a, b) => a + b, \"-\": (a, b) => a - b}\nops[\"-\"](10, 3)", want: "7"},
+		{src: "def apply(f, v) {\n  return f(v)\n}\napply((n) => n * 10, 4)", want: "40"},
+		{src: "def apply(f, v) {\n  return f(v)\n}\napply(def (s) { return s + \"!\" }, \"hi\")", want: "hi!"},
+		{src: "def maker() {\n  return (y) => y * 100\n}\nmaker()(3)", want: "300"},
+		{src: "((a, b) => a * b)(6, 7)", want: "42"},
+		{src: "var g = (x) => (y) => y + 1\ng(1)(2)", want: "3"},
+		{src: "def (x) { return x }\n(1 + 2) * 3", want: "9"},
+		{src: "(1, 2)", err: `unexpected "," in parenthesized expression`},
+		{src: "(1) => 2", err: "lambda parameter must be an identifier"},
+		{src: "(a, 1) => a", err: "lambda parameter must be an identifier"},
+	})
+}
+
+func TestClosure(t *testing.T) {
+	counter := `def counter() {
+  var count = 0
+  def inc() {
+    count += 1
+    return count
+  }
+  return inc
+}
+`
+	memo := `def memo(f) {
+  var cache = {}
+  return def (n) {
+    if (cache[n] == none) {
+      cache[n] = f(n)
+    }
+    return cache[n]
+  }
+}
+var calls = 0
+def square(n) {
+  calls += 1
+  return n * n
+}
+var fast = memo(square)
+`
+	runCases(t, []evalCase{
+		{src: counter + "var c1 = counter()\nvar c2 = counter()\nc1()\nc1()\n[c1(), c2()]", want: "[3, 1]"},
+		{src: memo + "[fast(4), fast(4), fast(5), calls]", want: "[16, 16, 25, 2]"},
+		{src: "def adder(a) {\n  return (b) => (c) => a + b + c\n}\nadder(1)(2)(3)", want: "6"},
+		{src: "def fact() {\n  def f(n) {\n    if (n <= 1) { return 1 }\n    return n * f(n - 1)\n  }\n  return f(10)\n}\nfact()", want: "3628800"},
+		{src: "def loops() {\n  var fs = []\n  for (i in range(3)) {\n    fs.append(() => i)\n  }\n  return [fs[0](), fs[2]()]\n}\nloops()", want: "[2, 2]"},
+		{src: "def shared() {\n  var x = 1\n  var get = () => x\n  x = 42\n  return get()\n}\nshared()", want: "42"},
+		{src: "def outer() {\n  var n = 0\n  def bump() { n += 5 }\n  bump()\n  bump()\n  return n\n}\nouter()", want: "10"},
+		{src: "def a1() {\n  def helper() { return 1 }\n  return helper()\n}\ndef a2() {\n  def helper() { return 2 }\n  return helper()\n}\n[a1(), a2()]", want: "[1, 2]"},
+		{src: "def f() {\n  var g = () => y\n  var r = g()\n  var y = 1\n  return r\n}\nf()", err: "variable referenced before assignment"},
+	})
+}
+
+func TestDefaultsAndKeywords(t *testing.T) {
+	fn := "var base = 10\ndef f(a, b = base, c = none) {\n  return [a, b, c]\n}\nbase = 0\n"
+	runCases(t, []evalCase{
+		{src: fn + "f(1)", want: "[1, 10, None]"},
+		{src: fn + "f(1, 2, 3)", want: "[1, 2, 3]"},
+		{src: fn + "f(1, c = 3)", want: "[1, 10, 3]"},
+		{src: fn + "f(c = 3, a = 1, b = 2)", want: "[1, 2, 3]"},
+		{src: "var g = def (x, y = 2) { return x * y }\n[g(3), g(3, y = 4)]", want: "[6, 12]"},
+		{src: "def outer(n) {\n  def inner(k = n) { return k }\n  return inner()\n}\nouter(7)", want: "7"},
+		{src: "len(obj = [1, 2])", want: "2"},
+		{src: fn + "f()", err: `missing required argument "a"`},
+		{src: fn + "f(b = 2)", err: `missing required argument "a"`},
+		{src: fn + "f(1, 2, 3, 4)", err: "takes 3 positional argument(s) but 4 were given"},
+		{src: fn + "f(1, d = 4)", err: `unexpected keyword argument "d"`},
+		{src: fn + "f(1, a = 4)", err: `multiple values for argument "a"`},
+		{src: fn + "f(a = 1, a = 2)", err: "keyword argument a repeated"},
+		{src: fn + "f(a = 1, 2)", err: "positional argument follows keyword argument"},
+		{src: "def h(a = 1, b) { return b }", err: "non-default parameter b follows default parameter"},
+		{src: "print(end = 1)", err: `unexpected keyword argument "end"`},
+		{src: "range(stop = 3)", err: `range() got an unexpected keyword argument "stop"`},
+		{src: "range(start = 5)", err: `range() got an unexpected keyword argument "start"`},
+	})
+}
+
+func TestVariadicAndSpread(t *testing.T) {
+	fn := "def log(level, ...rest) {\n  return [level, rest]\n}\nvar arr = [4, 5]\n"
+	runCases(t, []evalCase{
+		{src: fn + "log(1)", want: "[1, []]"},
+		{src: fn + "log(1, 2, 3)", want: "[1, [2, 3]]"},
+		{src: fn + "log(...arr)", want: "[4, [5]]"},
+		{src: fn + "log(0, ...arr, 6, ...[7])", want: "[0, [4, 5, 6, 7]]"},
+		{src: fn + "log(...[], level = 3)", want: "[3, []]"},
+		{src: "def f(a, b = 2, ...more) { return [a, b, more] }\n[f(1), f(...[1, 3, 5, 7])]", want: "[[1, 2, []], [1, 3, [5, 7]]]"},
+		{src: "var sum = def (...xs) {\n  var s = 0\n  for (x in xs) { s += x }\n  return s\n}\nsum(...range(5), 10)", want: "20"},
+		{src: "len(...[[1, 2, 3]])", want: "3"},
+		{src: fn + "log(...5)", err: "argument after ... must be iterable, not Int"},
+		{src: fn + "log(1, 2, level = 3)", err: `multiple values for argument "level"`},
+		{src: "def g(...xs, y) { return y }", err: "variadic parameter xs must be the last parameter"},
+	})
+}
+
+func TestUnpack(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var a, b = 1, 2\na, b = b, a\n[a, b]", want: "[2, 1]"},
+		{src: "def divmod(x, y) {\n  return x // y, x % y\n}\nvar q, r = divmod(7, 2)\n[q, r]", want: "[3, 1]"},
+		{src: "var x, [y, [z, w]] = 1, [2, [3, 4]]\n[x, y, z, w]", want: "[1, 2, 3, 4]"},
+		{src: "var [m, n] = \"hi\"\nm + n", want: "hi"},
+		{src: "var k, v = {\"a\": 1, \"b\": 2}\n[k, v]", want: "['a', 'b']"},
+		{src: "def f() {\n  var i, j = 0, 10\n  i, j = j, i + 1\n  return [i, j]\n}\nf()", want: "[10, 1]"},
+		{src: "var p, s = 0, 0\nfor (pair in [[1, 2], [3, 4]]) {\n  var l, r = pair\n  p, s = p + l, s + r\n}\n[p, s]", want: "[4, 6]"},
+		{src: "var u, v = [1, 2, 3]", err: "cannot unpack 3 values into 2 variables"},
+		{src: "var u, [v, w] = 1, [2]", err: "cannot unpack 1 values into 2 variables"},
+		{src: "var u, v = 5", err: "cannot unpack non-iterable Int object"},
+		{src: "var u, v = 1, 2, 3", err: "cannot assign 3 values to 2 targets"},
+		{src: "var u, 1 = 1, 2", err: "cannot assign to \"1\""},
+	})
+}
+
+func TestConditional(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var x = 1 if 2 > 1 else 2\nx", want: "1"},
+		{src: "var n = 0\n\"neg\" if n < 0 else \"zero\" if n == 0 else \"pos\"", want: "zero"},
+		{src: "def sign(n) { return -1 if n < 0 else 1 }\n[sign(-5), sign(5)]", want: "[-1, 1]"},
+		{src: "var calls = 0\ndef hit() {\n  calls += 1\n  return calls\n}\n[0 if true else hit(), hit() if false else 0, calls]", want: "[0, 0, 0]"},
+		{src: "var f = (n) => \"even\" if n % 2 == 0 else \"odd\"\nf(3) + f(4)", want: "oddeven"},
+		{src: "var a = 1\nif (a > 0) {\n  a = 2\n}\nif (a > 1) {\n  a = 3\n}\na", want: "3"},
+		{src: "var x = 1 if true", err: `expected "else" but found end of file`},
+		{src: "var z = if (true) {1} else {2}", err: "if block does not produce a value"},
+		{src: "var z = for (i in [1]) { i }", err: "for loop does not produce a value"},
+		{src: "var f = (n) => if (n) {1}", err: "if block does not produce a value"},
+	})
+}
+
+func TestShortCircuit(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var name = none\nname or \"default\"", want: "default"},
+		{src: "var name = \"bob\"\nname or \"default\"", want: "bob"},
+		{src: "0 and 1 / 0", want: "0"},
+		{src: "1 and 2", want: "2"},
+		{src: "0 or \"\"", want: ""},
+		{src: "var x = none\nx != none and len(x) > 0", want: "false"},
+		{src: "var x = [1]\nx != none and len(x) > 0", want: "true"},
+		{src: "1 < 2 and 3 > 2 or false", want: "true"},
+		{src: "[not none, not 0, not 0.0, not 2, not \"\", not [], not false]", want: "[true, true, true, false, false, false, true]"},
+		{src: "var x = none\nnot x and 1", want: "1"},
+		{src: "var calls = 0\ndef hit() {\n  calls += 1\n  return true\n}\n[true or hit(), false and hit(), false or hit(), calls]", want: "[true, false, true, 1]"},
+	})
+}
+
+func TestMembershipAndChains(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var m = {\"a\": 1}\n[\"a\" in m, \"b\" in m, \"b\" not in m]", want: "[true, false, true]"},
+		{src: "[\"ell\" in \"hello\", \"x\" not in \"hello\", 2 in [1, 2.0], 3 in [1, 2]]", want: "[true, true, true, false]"},
+		{src: "[4 in range(0, 10, 2), 5 in range(0, 10, 2), 4 in range(10, 0, -2), 12 in range(10, 0, -2)]", want: "[true, false, true, false]"},
+		{src: "var i = 3\nvar n = 5\n0 <= i < n", want: "true"},
+		{src: "var i = 5\n0 <= i < 5", want: "false"},
+		{src: "1 < 2 > 3", want: "false"},
+		{src: "1 == 1 != 2", want: "true"},
+		{src: "1 < 2 < 3 < 4 <= 4", want: "true"},
+		{src: "(1 < 2) == true", want: "true"},
+		{src: "1 < 2 == true", want: "false"},
+		{src: "var x = 2\n1 < x == 2", want: "true"},
+		{src: "[1 == 1 < 2, 3 & 1 == 1]", want: "[true, true]"},
+		{src: "var calls = 0\ndef mid() {\n  calls += 1\n  return 2\n}\n[1 < mid() < 3, 3 < mid() < 1, calls]", want: "[true, false, 2]"},
+		{src: "var k = \"a\"\nk in {\"a\": 1} and 1 < 2", want: "true"},
+		{src: "[[1] in [[2]], {\"a\": 1} in [{\"b\": 2}], [1, [2]] in [[1, [3]]], [1, [2.0]] in [[1, [2]]]]", want: "[false, false, false, true]"},
+		{src: "var m = {none: 1}\n[[3] in m, none in m]", want: "[false, true]"},
+		{src: "[[1] == [2], [1] != [1], {\"a\": [1]} == {\"a\": [1]}, {\"a\": 1} == {\"a\": 2}, {\"a\": 1} == {\"b\": 1}, [] == none]", want: "[false, false, true, false, false, false]"},
+		{src: "1 in 2", err: "argument of type Int is not iterable"},
+		{src: "1 in \"abc\"", err: "'in <String>' requires String as left operand, not Int"},
+		{src: "1 not 2", err: `expected "in" but found "2"`},
+	})
+}
+
+func TestIndexAssign(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "var grid = [[1, 2], [3, 4]]\ngrid[1][0] = 0\ngrid", want: "[[1, 2], [0, 4]]"},
+		{src: "var cfg = {\"a\": {}}\ncfg[\"a\"][\"b\"] = 1\ncfg", want: `{"a": {"b": 1}}`},
+		{src: "var counts = {}\nfor (w in [\"x\", \"y\", \"x\"]) {\n  if (w not in counts) {\n    counts[w] = 0\n  }\n  counts[w] += 1\n}\ncounts", want: `{"x": 2, "y": 1}`},
+		{src: "var m = [[1], [2]]\nm[0][0] *= 10\nm[-1][0] -= 1\nm", want: "[[10], [1]]"},
+		{src: "var calls = 0\ndef k() {\n  calls += 1\n  return 0\n}\nvar a = [[5]]\na[k()][k()] += 1\n[a, calls]", want: "[[[6]], 2]"},
+		{src: "def f() {\n  var t = {\"n\": [0, 0]}\n  t[\"n\"][1] = 7\n  return t\n}\nf()", want: `{"n": [0, 7]}`},
+		{src: "var arr = [1, 2, 3]\narr[1]", want: "2"},
+		{src: "var g = [[1], [2]]\ndef f() {\n  return g\n}\nf()[0][0] = 9\nf()[1][0] += 5\ng", want: "[[9], [7]]"},
+		{src: "var inner = [0]\nvar t = [inner]\nt.pop()[0] = 3\ninner", want: "[3]"},
+		{src: "[[7]][0][0] = 1\n2", want: "2"},
+		{src: "var a = [1]\na[0](1) = 2", err: "cannot assign to a[0](1)"},
+		{src: "def f() {\n  return 1\n}\nf() = 2", err: "cannot assign to f()"},
+	})
+}
+
+func TestMethodChains(t *testing.T) {
+	runCases(t, []evalCase{
+		{src: "def get_list() {\n  return [1, 2]\n}\nget_list().append(3)", want: "None"},
+		{src: "var arr = [\"ab\", [1]]\narr[1].append(5)\n[arr[0].upper(), arr]", want: "['AB', ['ab', [1, 5]]]"},
+		{src: "\"a,b\".split(\",\")[1]", want: "b"},
+		{src: "var m = {\"k\": [1, 2, 3]}\nvar v = m[\"k\"].pop()\n[v, m]", want: `[3, {"k": [1, 2]}]`},
+		{src: "var s = \"x\"\n\"y\" + s.upper()", want: "yX"},
+		{src: "var g = [[[1]]]\ng[0][0].append(2)\ng", want: "[[[1, 2]]]"},
+		{src: "def f() {\n  var q = [1]\n  def add() {\n    q.append(2)\n  }\n  add()\n  return q\n}\nf()", want: "[1, 2]"},
+		{src: "var q = [1, 2]\nvar c = q[0:1]\nc.append(9)\n[c, q]", want: "[[1, 9], [1, 2]]"},
+		{src: "[1].foo()", err: `Object Array don't has method "foo"`},
+	})
+}
+
+func TestRuntimeErrorSpans(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"var a = 1\nprint(a / 0)", "a / 0"},
+		{"def f(x) {\n  return x[5]\n}\nvar y = f([1]) + 1", "x[5]"},
+		{"[1].foo()", "foo"},
+	}
+	for _, tt := range tests {
+		_, err := eval(tt.src)
+		d, ok := err.(errors.Diagnostic)
+		if !ok {
+			t.Errorf("%q: got error %v (%T), want a Diagnostic", tt.src, err, err)
+			continue
+		}
+		if got := tt.src[d.Span.Start.Offset:d.Span.End.Offset]; got != tt.want {
+			t.Errorf("%q: error spans %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}